@@ -0,0 +1,106 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"context"
+	"fmt"
+)
+
+// Action is what an ActionCallback wants the monitor to do next, which keeps
+// "stop monitoring" apart from "something went wrong", rather than telling
+// them apart by whether the error is ErrStopMonitoring.
+type Action int
+
+const (
+	// ActionContinue keeps monitoring. This is a nil error from a
+	// MonitorCallback.
+	ActionContinue Action = iota
+
+	// ActionStop stops monitoring, without an error. This is returning
+	// ErrStopMonitoring from a MonitorCallback.
+	ActionStop
+
+	// ActionReconfigure re-arms the trigger with the Event's Config, which
+	// the callback is expected to have changed. This is returning a new
+	// Config from a ReconfigureCallback.
+	ActionReconfigure
+)
+
+// String will return the name of the Action, such as "continue".
+func (a Action) String() string {
+	switch a {
+	case ActionContinue:
+		return "continue"
+	case ActionStop:
+		return "stop"
+	case ActionReconfigure:
+		return "reconfigure"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// ActionCallback is like EventCallback, but returns what to do next, and
+// only returns an error if something actually went wrong, in which case the
+// Action is ignored, and monitoring stops with that error.
+//
+// The Event is passed by pointer so that its Config can be changed along
+// with returning ActionReconfigure; changing it otherwise does nothing.
+type ActionCallback func(*Event) (Action, error)
+
+// ActionsFrom adapts a MonitorCallback into an ActionCallback: a nil error
+// is ActionContinue, ErrStopMonitoring is ActionStop, and any other error is
+// returned as-is.
+func ActionsFrom(cb MonitorCallback) ActionCallback {
+	return func(*Event) (Action, error) {
+		switch err := cb(); err {
+		case nil:
+			return ActionContinue, nil
+		case ErrStopMonitoring:
+			return ActionStop, nil
+		default:
+			return ActionContinue, err
+		}
+	}
+}
+
+// MonitorActions is like MonitorReconfigurable, but with an ActionCallback,
+// until the callback returns ActionStop (in which case nil is returned) or
+// an error, or the context is cancelled (in which case ctx.Err() is).
+func MonitorActions(ctx context.Context, config Config, cb ActionCallback) error {
+	return MonitorReconfigurable(ctx, config, func(event Event) (*Config, error) {
+		action, err := cb(&event)
+		if err != nil {
+			return nil, err
+		}
+		switch action {
+		case ActionContinue:
+			return nil, nil
+		case ActionStop:
+			return nil, ErrStopMonitoring
+		case ActionReconfigure:
+			return &event.Config, nil
+		}
+		return nil, fmt.Errorf("psi: unknown %s", action)
+	})
+}
+
+// vim: foldmethod=marker
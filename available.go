@@ -0,0 +1,71 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"os"
+)
+
+// Available will return true if backpressure can be monitored on all of
+// ResourceCPU, ResourceIO and ResourceMemory. Use Probe or ProbeStatus to
+// find out why if it can't.
+func Available() bool {
+	for _, resource := range knownResources {
+		if !AvailableResource(resource) {
+			return false
+		}
+	}
+	return true
+}
+
+// AvailableResource will return true if backpressure can be monitored on the
+// provided Resource.
+func AvailableResource(resource Resource) bool {
+	return Probe(resource) == nil
+}
+
+// Probe will check that the pressure file for the provided Resource exists
+// and can be opened for writing, which is needed to set up a trigger. This
+// is a cheap way to find out up front if Monitor has any hope of working.
+//
+// If the pressure file doesn't exist, either the kernel was built without
+// CONFIG_PSI, or PSI was disabled at boot (psi=0), and the returned error
+// will match ErrPSIUnsupported (and os.ErrNotExist) using errors.Is. If
+// we're not allowed to set up triggers, the returned error will satisfy
+// os.IsPermission.
+func Probe(resource Resource) error {
+	config := Config{Resource: resource}
+	fd, err := config.open(os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	return fd.Close()
+}
+
+// SupportsFullCPU will return true if the kernel reports "full" pressure for
+// ResourceCPU, which was added in Linux 5.13. Older kernels only report
+// "some" pressure for the CPU, and can't monitor StallTypeFull on it.
+func SupportsFullCPU() bool {
+	pressure, err := ReadPressure(ResourceCPU)
+	return err == nil && pressure.Full != nil
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,197 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// PanicError is returned from a monitor when its callback panics, and
+// Config.RecoverPanics is set.
+type PanicError struct {
+	// Value is what the callback panicked with.
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine at the time of the panic.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: %v\n%s", ErrCallbackPanic, e.Value, e.Stack)
+}
+
+func (e *PanicError) Is(target error) bool {
+	return target == ErrCallbackPanic
+}
+
+// wrapCallback will wrap a callback with everything the Config asks to
+// happen around it, returning one for when the trigger fires, and one for
+// the call made because of FireOnStart. The initial call didn't come from the
+// trigger, so it isn't rate limited (otherwise it'd use up the
+// MinCallbackInterval, and the first real stall would be dropped), and isn't
+// counted as a wakeup.
+func (c Config) wrapCallback(cb func() error) (fire, fireInitial func() error) {
+	cb = c.stats.countDroppedErrors(cb)
+	if c.RecoverPanics {
+		cb = recoverPanics(cb)
+	}
+	if c.OnCallbackDuration != nil {
+		cb = timeCallback(c.OnCallbackDuration, cb)
+	}
+	if c.stats != nil {
+		cb = c.stats.countErrors(cb)
+	}
+	if c.ContinueOnCallbackError {
+		cb = c.logErrors(cb)
+	}
+	initial := cb
+
+	var onDrop func()
+	if c.stats != nil {
+		onDrop = c.stats.countDropped
+	}
+	cb = rateLimit(c.MinCallbackInterval, cb, onDrop)
+	if c.stats != nil {
+		cb = c.stats.countWakeups(cb)
+	}
+
+	logger := c.logger()
+	fire = func() error {
+		logger.Debug("psi: trigger fired", c.logArgs()...)
+		return cb()
+	}
+	fireInitial = func() error {
+		logger.Debug("psi: firing on start", c.logArgs()...)
+		return initial()
+	}
+	return fire, fireInitial
+}
+
+// recoverPanics will wrap a callback so that a panic is returned as a
+// *PanicError, rather than unwinding any further.
+func recoverPanics(cb func() error) func() error {
+	return func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+		return cb()
+	}
+}
+
+// logErrors will wrap a callback so that any error it returns (other than
+// ErrStopMonitoring) is logged, rather than returned.
+func (c Config) logErrors(cb func() error) func() error {
+	logger := c.logger()
+	return func() error {
+		err := cb()
+		if err == nil || err == ErrStopMonitoring {
+			return err
+		}
+		logger.Warn("psi: callback failed", c.logArgs("err", err)...)
+		return nil
+	}
+}
+
+// timeCallback will wrap a callback so that how long it takes is passed to
+// report after each call.
+func timeCallback(report func(time.Duration), cb func() error) func() error {
+	return func() error {
+		start := clock.Now()
+		err := cb()
+		report(clock.Since(start))
+		return err
+	}
+}
+
+// rateLimit will wrap a callback so that it's invoked at most once per
+// interval, dropping any calls in between, and invoking onDrop (if it's not
+// nil) for each one dropped. An interval of 0 doesn't limit anything.
+//
+// There's no need to drain anything when dropping an event; the kernel
+// clears the event on the trigger as part of the Poll that reported it.
+func rateLimit(interval time.Duration, cb func() error, onDrop func()) func() error {
+	if interval <= 0 {
+		return cb
+	}
+	var last time.Time
+	return func() error {
+		now := clock.Now()
+		if !last.IsZero() && now.Sub(last) < interval {
+			if onDrop != nil {
+				onDrop()
+			}
+			return nil
+		}
+		last = now
+		return cb()
+	}
+}
+
+// Throttle will wrap a MonitorCallback so that it's only invoked once the
+// trigger has fired at least n times within the window, such as to only
+// start shedding load once pressure has been tripping the trigger over and
+// over, rather than on the first blip.
+//
+// Once the threshold is reached, the callback is invoked for every event for
+// as long as the last n of them all fall within the window. Events that
+// don't make the cut return ErrDropped, which monitors count in
+// Stats.Dropped rather than treating as an error; anything calling the
+// callback itself should do the same.
+func Throttle(n int, window time.Duration, cb MonitorCallback) MonitorCallback {
+	if n <= 1 {
+		return cb
+	}
+
+	var (
+		mu    sync.Mutex
+		times = make([]time.Time, n)
+		next  int
+		seen  int
+	)
+	return func() error {
+		now := clock.Now()
+
+		mu.Lock()
+		// times is a ring of the last n events, so once this one is
+		// in, the next slot over is the oldest of them.
+		times[next] = now
+		next = (next + 1) % n
+		if seen < n {
+			seen++
+		}
+		fire := seen == n && now.Sub(times[next]) <= window
+		mu.Unlock()
+
+		if !fire {
+			return ErrDropped
+		}
+		return cb()
+	}
+}
+
+// vim: foldmethod=marker
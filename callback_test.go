@@ -0,0 +1,80 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi_test
+
+import (
+	"testing"
+	"time"
+
+	"pault.ag/go/psi"
+	"pault.ag/go/psi/psitest"
+)
+
+func TestThrottle(t *testing.T) {
+	clock := psitest.NewClock(time.Unix(0, 0))
+	defer clock.Install()()
+
+	calls := 0
+	cb := psi.Throttle(3, time.Second, func() error {
+		calls++
+		return nil
+	})
+
+	for i, step := range []struct {
+		advance time.Duration
+		want    error
+	}{
+		{0, psi.ErrDropped},
+		{500 * time.Millisecond, psi.ErrDropped},
+		{500 * time.Millisecond, nil},            // 3 in exactly 1s
+		{400 * time.Millisecond, nil},            // the last 3 in 900ms
+		{700 * time.Millisecond, psi.ErrDropped}, // the last 3 in 1.1s
+		{2 * time.Second, psi.ErrDropped},
+		{100 * time.Millisecond, psi.ErrDropped},
+		{100 * time.Millisecond, nil}, // 3 in 200ms
+	} {
+		clock.Advance(step.advance)
+		if err := cb(); err != step.want {
+			t.Fatalf("call %d = %v, want %v", i, err, step.want)
+		}
+	}
+	if calls != 3 {
+		t.Fatalf("callback invoked %d times, want 3", calls)
+	}
+}
+
+func TestThrottleOnce(t *testing.T) {
+	calls := 0
+	cb := psi.Throttle(1, time.Second, func() error {
+		calls++
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		if err := cb(); err != nil {
+			t.Fatalf("call %d = %v", i, err)
+		}
+	}
+	if calls != 3 {
+		t.Fatalf("callback invoked %d times, want 3", calls)
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,274 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrNoCgroup2 is returned when a process isn't in a cgroup v2
+	// hierarchy, such as on systems only using cgroup v1.
+	ErrNoCgroup2 error = fmt.Errorf("psi: process is not in a cgroup v2 hierarchy")
+
+	// ErrRootCgroup is returned when a process is in the root cgroup, which
+	// has no pressure files of its own. Use the system-wide pressure in
+	// /proc/pressure instead.
+	ErrRootCgroup error = fmt.Errorf("psi: process is in the root cgroup")
+
+	// ErrCgroup2NotMounted is returned when there's no cgroup2 filesystem
+	// where the cgroup2 hierarchy is expected to be mounted.
+	ErrCgroup2NotMounted error = fmt.Errorf("psi: cgroup2 is not mounted")
+
+	// ErrProcessNotFound is returned by MonitorPID when there's no process
+	// with the provided pid, such as because it's already exited.
+	ErrProcessNotFound error = fmt.Errorf("psi: no such process")
+)
+
+// ReadCgroupPressure will read the current backpressure on the provided
+// Resource for a cgroup v2 cgroup, such as "system.slice/foo.service", which
+// is relative to the cgroup2 mount at /sys/fs/cgroup. This doesn't set up a
+// trigger, so it's a cheap way to sample lots of cgroups.
+//
+// If there's no cgroup2 filesystem mounted at /sys/fs/cgroup, the returned
+// error will match ErrCgroup2NotMounted. To read from a cgroup2 hierarchy
+// mounted somewhere else, use Config.ReadPressure with a CgroupRoot.
+func ReadCgroupPressure(cgroupPath string, resource Resource) (Pressure, error) {
+	return Config{Resource: resource, CgroupPath: cgroupPath}.ReadPressure()
+}
+
+// maxSampleParallelism is how many pressure files SampleCgroups reads at
+// once.
+const maxSampleParallelism = 16
+
+// SampleCgroups will read the current backpressure on the provided Resource
+// for each of the provided cgroups (in the same form as CgroupPath), a few
+// at a time, returning the Pressure for each, keyed by path.
+//
+// Cgroups that have gone away since the paths were found (such as from
+// ListCgroupsWithPressure) are left out, rather than counted as errors.
+// Other errors don't stop the rest of the cgroups from being read; they're
+// returned joined together (using errors.Join), along with whatever could be
+// read.
+func SampleCgroups(paths []string, resource Resource) (map[string]Pressure, error) {
+	if err := (Config{Resource: resource}).checkCgroup2(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		path     string
+		pressure Pressure
+		err      error
+	}
+	results := make(chan result, len(paths))
+	sem := make(chan struct{}, maxSampleParallelism)
+	for _, path := range paths {
+		sem <- struct{}{}
+		go func(path string) {
+			defer func() { <-sem }()
+			config := Config{Resource: resource, CgroupPath: path}
+			fd, err := config.open(os.O_RDONLY)
+			if err != nil {
+				results <- result{path: path, err: err}
+				return
+			}
+			defer fd.Close()
+			pressure, err := readPressureAt(fd)
+			results <- result{path: path, pressure: pressure, err: err}
+		}(path)
+	}
+
+	pressures := make(map[string]Pressure, len(paths))
+	var errs []error
+	for range paths {
+		result := <-results
+		switch {
+		case result.err == nil:
+			pressures[result.path] = result.pressure
+		case os.IsNotExist(result.err):
+		default:
+			errs = append(errs, fmt.Errorf("psi: %s: %w", result.path, result.err))
+		}
+	}
+	return pressures, errors.Join(errs...)
+}
+
+// maxCgroupDepth is how deep ListCgroupsWithPressure will go into the cgroup
+// hierarchy. Real hierarchies are nowhere near this deep.
+const maxCgroupDepth = 32
+
+// ListCgroupsWithPressure will walk the cgroup2 hierarchy mounted at
+// /sys/fs/cgroup, and return the path of every cgroup with a pressure file
+// for the provided Resource, such as "/system.slice/foo.service", in the same
+// form as CgroupPath (and /proc/self/cgroup). This is handy for an agent to
+// find what there is to monitor.
+//
+// Subtrees we aren't allowed to read are skipped, as is anything more than
+// 32 levels deep. If there's no cgroup2 filesystem mounted, the returned
+// error will match ErrCgroup2NotMounted.
+func ListCgroupsWithPressure(resource Resource) ([]string, error) {
+	config := Config{Resource: resource}
+	if err := config.checkCgroup2(); err != nil {
+		return nil, err
+	}
+
+	root := config.cgroupRoot()
+	name := fmt.Sprintf("%s.pressure", resource)
+	var cgroups []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrPermission) {
+				if d != nil && d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." && strings.Count(rel, string(filepath.Separator)) >= maxCgroupDepth {
+			return fs.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+			cgroups = append(cgroups, filepath.Clean("/"+rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cgroups, nil
+}
+
+// checkCgroup2 will make sure there's a cgroup2 filesystem mounted at the
+// Config's CgroupRoot, to give a better error than the pressure file not
+// existing.
+func (c Config) checkCgroup2() error {
+	root := c.cgroupRoot()
+	ok, err := isCgroup2(root)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w at %s", ErrCgroup2NotMounted, root)
+	}
+	return nil
+}
+
+// MonitorSelfCgroup is Monitor, but for the pressure on the cgroup this
+// process is in, rather than the system-wide pressure. This is handy inside
+// a container, to watch the container's pressure rather than the host's.
+//
+// This assumes the unified (cgroup v2) hierarchy is mounted at
+// /sys/fs/cgroup, unless the Config has a CgroupRoot. If the process isn't
+// in a cgroup v2 hierarchy, this will return ErrNoCgroup2, and if it's in the
+// root cgroup, ErrRootCgroup. Any CgroupPath already set on the Config is
+// replaced.
+func MonitorSelfCgroup(config Config, cb MonitorCallback) error {
+	config, err := procCgroupConfig("/proc/self/cgroup", config)
+	if err != nil {
+		return err
+	}
+	return Monitor(config, cb)
+}
+
+// MonitorPID is MonitorSelfCgroup, but for the cgroup some other process is
+// in, such as a supervisor watching a child it started. The cgroup is looked
+// up once, from /proc/<pid>/cgroup, when monitoring starts; if the process
+// moves to another cgroup after that, this keeps watching the old one.
+//
+// This needs the unified (cgroup v2) hierarchy, with the controller for the
+// Resource enabled on the cgroup (or else there's no pressure file for it);
+// on a cgroup v1 only system this will return ErrNoCgroup2. If there's no
+// such process (or it's already exited), this will return an error matching
+// ErrProcessNotFound. Once monitoring, if the cgroup goes away (such as when
+// the last process in it exits), this returns an error from the trigger.
+func MonitorPID(pid int, config Config, cb MonitorCallback) error {
+	if pid <= 0 {
+		return fmt.Errorf("%w: invalid pid %d", ErrProcessNotFound, pid)
+	}
+	config, err := procCgroupConfig(fmt.Sprintf("/proc/%d/cgroup", pid), config)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: pid %d", ErrProcessNotFound, pid)
+		}
+		return err
+	}
+	return Monitor(config, cb)
+}
+
+// procCgroupConfig will set the CgroupPath on the Config to the cgroup listed
+// in the provided /proc/<pid>/cgroup file.
+func procCgroupConfig(procPath string, config Config) (Config, error) {
+	path, err := readCgroupPath(procPath)
+	if err != nil {
+		return config, err
+	}
+	config.CgroupPath = path
+
+	// From inside a cgroup namespace, our cgroup looks like the root, but
+	// it has pressure files, since it's not really the root.
+	if path == "/" {
+		if _, err := os.Stat(config.path()); os.IsNotExist(err) {
+			return config, ErrRootCgroup
+		}
+	}
+	return config, nil
+}
+
+// readCgroupPath will read a /proc/<pid>/cgroup file, and return the path of
+// the cgroup v2 cgroup it lists, relative to the cgroup2 mount.
+func readCgroupPath(path string) (string, error) {
+	fd, err := openFile(path, os.O_RDONLY)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		// cgroup v2 is always listed as hierarchy 0, with no
+		// controllers, such as "0::/system.slice/foo.service".
+		line := scanner.Text()
+		if strings.HasPrefix(line, "0::") {
+			return strings.TrimPrefix(line, "0::"), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", ErrNoCgroup2
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,98 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+//go:build linux
+// +build linux
+
+package psi_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pault.ag/go/psi"
+	"pault.ag/go/psi/psitest"
+)
+
+// closeTwice will Close c twice, failing the test if the second one returns
+// an error. A panic fails the test all by itself.
+func closeTwice(t *testing.T, c interface{ Close() error }) {
+	t.Helper()
+	if err := c.Close(); err != nil {
+		t.Fatalf("first Close() = %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("second Close() = %v, want nil", err)
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	t.Run("Source", func(t *testing.T) {
+		source, err := psitest.NewSource("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		closeTwice(t, source)
+	})
+
+	t.Run("Trigger", func(t *testing.T) {
+		source, err := psitest.NewSource("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		trigger, err := psi.NewTriggerFromSource(testConfig, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		closeTwice(t, trigger)
+	})
+
+	t.Run("Sampler", func(t *testing.T) {
+		sampler, err := psi.NewSampler()
+		if err != nil {
+			t.Skip(err)
+		}
+		closeTwice(t, sampler)
+	})
+
+	t.Run("Group", func(t *testing.T) {
+		// A regular file never reports an event, so the monitor just
+		// sits there until it's closed.
+		config := testConfig
+		config.Resource = ""
+		config.Path = filepath.Join(t.TempDir(), "memory")
+		if err := os.WriteFile(config.Path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		var group psi.Group
+		if err := group.Add(config, func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		if err := group.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		closeTwice(t, &group)
+	})
+}
+
+// vim: foldmethod=marker
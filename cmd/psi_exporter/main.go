@@ -0,0 +1,19 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"pault.ag/go/psi/psiprom"
+)
+
+func main() {
+	if err := psiprom.Register(prometheus.DefaultRegisterer); err != nil {
+		panic(err)
+	}
+	http.Handle("/metrics", promhttp.Handler())
+	log.Fatal(http.ListenAndServe(":9101", nil))
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"time"
 
@@ -8,6 +9,19 @@ import (
 )
 
 func main() {
+	oom := flag.Bool("oom", false, "watch for memory pressure that may lead to an OOM")
+	flag.Parse()
+
+	if *oom {
+		if err := psi.MonitorMemoryFull(time.Second/10, time.Second, func(e psi.Event) error {
+			fmt.Printf("memory full avg10=%.2f\n", e.Pressure.Full.Avg10)
+			return nil
+		}); err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	if err := psi.Monitor(psi.Config{
 		Resource:            psi.ResourceCPU,
 		Type:                psi.StallTypeSome,
@@ -0,0 +1,168 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// resourceError is an error that happened while dealing with a specific
+// Resource, which is one of our sentinel errors as far as errors.Is is
+// concerned, but still unwraps to the error that actually happened.
+type resourceError struct {
+	resource Resource
+	kind     error
+	err      error
+}
+
+func (e *resourceError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.kind, e.resource, e.err)
+}
+
+func (e *resourceError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *resourceError) Unwrap() error {
+	return e.err
+}
+
+// ConfigError is returned by Config.Check when one of the durations is out of
+// range, with the name of the field and the range it needs to be in, so
+// tooling can clamp the value or point at exactly what's wrong.
+type ConfigError struct {
+	// Field is the name of the Config field, such as "WindowDuration".
+	Field string
+
+	// Value is the value of the field.
+	Value time.Duration
+
+	// Min and Max are the range the field needs to be in, inclusive. For
+	// the StallWindowDuration, Max takes the WindowDuration into account.
+	Min time.Duration
+	Max time.Duration
+}
+
+func (e *ConfigError) Error() string {
+	if e.Value < e.Min {
+		return fmt.Sprintf("Minimum %s is %s", e.Field, e.Min)
+	}
+	return fmt.Sprintf("Maximum %s is %s", e.Field, e.Max)
+}
+
+// ReadAllError is returned by ReadAll when some of the Resources couldn't be
+// read. The ones that could are still returned.
+type ReadAllError struct {
+	// Errors has the error for each Resource that couldn't be read.
+	Errors map[Resource]error
+}
+
+func (e *ReadAllError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, resource := range knownResources {
+		if err, ok := e.Errors[resource]; ok {
+			parts = append(parts, fmt.Sprintf("%s: %s", resource, err))
+		}
+	}
+	return fmt.Sprintf("psi: couldn't read %s", strings.Join(parts, "; "))
+}
+
+// Unwrap returns the errors for each Resource, so that errors.Is and
+// errors.As look at all of them.
+func (e *ReadAllError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, resource := range knownResources {
+		if err, ok := e.Errors[resource]; ok {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// triggerFailure is returned by watch when the kernel reports an error on
+// one of the triggers, so we know which one it was.
+type triggerFailure struct {
+	index int
+	err   error
+}
+
+func (e *triggerFailure) Error() string {
+	return e.err.Error()
+}
+
+func (e *triggerFailure) Unwrap() error {
+	return e.err
+}
+
+// TriggerError is returned when the kernel refuses to set up the trigger
+// described by a Config. If the kernel doesn't support PSI triggers at all,
+// this will match ErrTriggerUnsupported using errors.Is.
+type TriggerError struct {
+	// Config is the Config the trigger was for.
+	Config Config
+
+	// Trigger is exactly what we tried to write to the pressure file,
+	// without the trailing NUL.
+	Trigger string
+
+	// Err is the error returned by the write.
+	Err error
+}
+
+func (e *TriggerError) Error() string {
+	got := explainTriggerError(e.Err)
+	if got == "" {
+		got = e.Err.Error()
+	}
+	return fmt.Sprintf(
+		"psi: %s: tried to set %q on %s and got %s",
+		e.Config.Resource,
+		e.Trigger,
+		e.Config.path(),
+		got,
+	)
+}
+
+func (e *TriggerError) Is(target error) bool {
+	return target == ErrTriggerUnsupported && errors.Is(e.Err, syscall.ENOTSUP)
+}
+
+func (e *TriggerError) Unwrap() error {
+	return e.Err
+}
+
+// checkOpen will turn an error opening the pressure file for the Config into
+// ErrPSIUnsupported if the file isn't there. Cgroup pressure files going
+// missing is more likely the cgroup being gone than the kernel lacking PSI,
+// so those are left alone.
+func (c Config) checkOpen(err error) error {
+	if c.CgroupPath == "" && c.Path == "" && os.IsNotExist(err) {
+		return &resourceError{resource: c.Resource, kind: ErrPSIUnsupported, err: err}
+	}
+	return err
+}
+
+// vim: foldmethod=marker
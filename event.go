@@ -0,0 +1,307 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// Event is passed to an EventCallback every time the backpressure thresholds
+// exceed the provided configuration. Everything that hands out Events (the
+// callbacks, MonitorChan, Group and so on) uses this same type, and since it
+// carries the Config along with it, handlers don't need to close over which
+// Resource, Type or windows they were set up with.
+//
+// Events marshal to JSON for logging, with the Config as it is in a config
+// file, such as:
+//
+//	{"config":{"resource":"memory","type":"some","stall_window":"150ms",...},
+//	 "time":"...","pressure":{"some":{...},"full":{...}},"seq":3}
+type Event struct {
+	// Config is the Config whose thresholds were exceeded, including the
+	// Resource, Type, StallWindowDuration and WindowDuration.
+	Config Config `json:"config"`
+
+	// Time is when we woke up to handle the event.
+	Time time.Time `json:"time"`
+
+	// Pressure is the backpressure on the Resource, as read right after
+	// waking up (and after Time was taken), in a single read of the
+	// trigger's own fd, before the callback is invoked. This has both the
+	// "some" and "full" numbers, whichever Type the Config is for, so a
+	// "full" trigger can be weighed up against how much "some" pressure
+	// there was at the same time. Full is nil only if the kernel doesn't
+	// report it for the Resource.
+	Pressure Pressure `json:"pressure"`
+
+	// Initial is set if this Event didn't come from the trigger, but was
+	// made up right after the trigger was set up, because of
+	// Config.FireOnStart.
+	Initial bool `json:"initial,omitempty"`
+
+	// Seq counts the times the trigger has fired, starting from 1 for the
+	// first; the Initial Event is 0. Every time the trigger fires counts,
+	// even if the callback isn't invoked for it (such as because of
+	// MinCallbackInterval), so a gap in Seq means events were dropped.
+	// Along with Pressure.TotalStall, this is handy for lining up Events
+	// with logs.
+	Seq uint64 `json:"seq"`
+
+	// Dropped is how many times the trigger fired between the last Event
+	// the callback acted on and this one, without the callback acting on
+	// it, either because of MinCallbackInterval, or because the callback
+	// returned ErrDropped. That says how bursty the pressure was even
+	// when the Events were spaced out. This is 0 for the Initial Event.
+	Dropped uint64 `json:"dropped,omitempty"`
+}
+
+// EventCallback is like MonitorCallback, but is told about what happened.
+type EventCallback func(Event) error
+
+// String will render the Event's Pressure on one line, like Snapshot.String.
+func (e Event) String() string {
+	buf := make([]byte, 0, 128)
+	buf = append(buf, e.Config.Resource...)
+	buf = append(buf, ' ')
+	return string(e.Pressure.appendTo(buf))
+}
+
+// newEvent will build the Event for a Trigger that tripped (or was just set
+// up, if it's the initial wakeup), reading the pressure right from the
+// Trigger rather than opening the file again.
+func newEvent(trigger *Trigger, wake wakeup) (Event, error) {
+	now := clock.Now()
+	pressure, err := trigger.Read()
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		Config:   trigger.config,
+		Time:     now,
+		Pressure: pressure,
+		Initial:  wake.initial,
+		Seq:      wake.seq,
+		Dropped:  wake.dropped,
+	}, nil
+}
+
+// MonitorEvents is like Monitor, but will invoke an EventCallback with the
+// details of each Event, rather than a bare MonitorCallback.
+func MonitorEvents(config Config, cb EventCallback) error {
+	return MonitorEventsContext(context.Background(), config, cb)
+}
+
+// MonitorMemoryFull will invoke the provided callback every time all tasks
+// are stalled waiting on memory for at least threshold within window. This
+// is the canonical early warning of an impending OOM, and a good time to
+// reclaim memory (drop caches, shed load, and so on).
+//
+// The Event's Pressure.Full.Avg10 is a good measure of how bad things are,
+// to decide how drastic to be about it.
+func MonitorMemoryFull(threshold, window time.Duration, cb EventCallback) error {
+	return MonitorEvents(Config{
+		Resource:            ResourceMemory,
+		Type:                StallTypeFull,
+		StallWindowDuration: threshold,
+		WindowDuration:      window,
+	}, cb)
+}
+
+// MonitorEventsContext is like MonitorContext, but will invoke an
+// EventCallback with the details of each Event, rather than a bare
+// MonitorCallback.
+func MonitorEventsContext(ctx context.Context, config Config, cb EventCallback) error {
+	if err := config.Check(); err != nil {
+		return err
+	}
+
+	trigger, err := openTrigger(config)
+	if err != nil {
+		return err
+	}
+	return MonitorTrigger(ctx, trigger, cb)
+}
+
+// ErrTimeout is returned by WaitForStall when the context's deadline passes
+// before there's a stall. It also matches context.DeadlineExceeded, using
+// errors.Is.
+var ErrTimeout error = fmt.Errorf("psi: no stall before the deadline: %w", context.DeadlineExceeded)
+
+// ErrNoStall is returned by WaitForStall when the Config's OnTick stops
+// monitoring before there's a stall.
+var ErrNoStall error = fmt.Errorf("psi: stopped before there was a stall")
+
+// MonitorSomeAndFull will monitor both "some" and "full" backpressure on the
+// same Resource at once, invoking the EventCallback every time either one
+// trips. The Event's Config is whichever one it was, so its Type says which.
+// This is handy to warn on "some" pressure, and take drastic action on
+// "full" pressure, from the one place.
+//
+// Under the hood, this is two kernel triggers on two fds, waited on
+// together, just like MonitorThresholds. The some Config has to have
+// StallTypeSome, the full Config StallTypeFull, and both have to be for the
+// same Resource (and CgroupPath, or Path). If the callback returns
+// ErrStopMonitoring, both triggers are torn down, and nil is returned.
+func MonitorSomeAndFull(ctx context.Context, some, full Config, cb EventCallback) error {
+	if some.Type != StallTypeSome || full.Type != StallTypeFull {
+		return fmt.Errorf("psi: need one %s and one %s Config", StallTypeSome, StallTypeFull)
+	}
+	if !some.sameFile(full) {
+		return fmt.Errorf("psi: some and full Configs must be for the same Resource")
+	}
+
+	event := func(trigger *Trigger, wake wakeup) error {
+		event, err := newEvent(trigger, wake)
+		if err != nil {
+			return err
+		}
+		return cb(event)
+	}
+	return monitorAll(
+		ctx,
+		[]Config{some, full},
+		[]func(*Trigger, wakeup) error{event, event},
+		FailFast,
+	)
+}
+
+// WaitForStall will set up a trigger for the provided Config, and wait for it
+// to trip once, returning the Event for it. The trigger is closed before
+// WaitForStall returns, however it returns.
+//
+// If the context's deadline passes first, ErrTimeout is returned, so that
+// "no stall in time" can be told apart from something going wrong. If the
+// context is cancelled first, ctx.Err() is returned, and if the Config's
+// OnTick stops monitoring first, ErrNoStall is. FireOnStart is ignored,
+// since the point is to wait.
+func WaitForStall(ctx context.Context, config Config) (Event, error) {
+	config.FireOnStart = false
+
+	var (
+		event Event
+		fired bool
+	)
+	err := MonitorEventsContext(ctx, config, func(e Event) error {
+		event, fired = e, true
+		return ErrStopMonitoring
+	})
+	if err == context.DeadlineExceeded {
+		return Event{}, ErrTimeout
+	}
+	if err != nil {
+		return Event{}, err
+	}
+	if !fired {
+		return Event{}, ErrNoStall
+	}
+	return event, nil
+}
+
+// ReconfigureCallback is like EventCallback, but may return a new Config to
+// set the trigger up with from then on, such as to widen the window after the
+// first event to avoid flapping. Returning a nil Config leaves the trigger
+// alone. Every Config returned re-arms the trigger, so use Config.Equal to
+// skip returning one that hasn't changed.
+type ReconfigureCallback func(Event) (*Config, error)
+
+// errReconfigure is returned by the callback passed to run when the user's
+// callback asked for a new Config.
+var errReconfigure = fmt.Errorf("psi: reconfigure")
+
+// MonitorReconfigurable is like MonitorEventsContext, but the callback can
+// return a new Config to re-arm the trigger with.
+//
+// The kernel only allows one trigger per open pressure file, so to change
+// it, the old trigger is closed, and a new one is opened with the new Config.
+// Any stall during that (short) gap goes unnoticed. If the new Config doesn't
+// pass Check, or the new trigger can't be set up, that error is returned.
+func MonitorReconfigurable(ctx context.Context, config Config, cb ReconfigureCallback) error {
+	for {
+		if err := config.Check(); err != nil {
+			return err
+		}
+
+		trigger, err := openTrigger(config)
+		if err != nil {
+			return err
+		}
+
+		var next Config
+		err = run(ctx, trigger, func(trigger *Trigger, wake wakeup) error {
+			event, err := newEvent(trigger, wake)
+			if err != nil {
+				return err
+			}
+			reconfig, err := cb(event)
+			if err != nil {
+				return err
+			}
+			if reconfig != nil {
+				next = *reconfig
+				return errReconfigure
+			}
+			return nil
+		})
+		if err != errReconfigure {
+			return err
+		}
+		config = next
+	}
+}
+
+// MonitorChan will monitor backpressure in a new goroutine, sending an Event
+// on the returned channel every time the backpressure thresholds exceed the
+// provided configuration.
+//
+// Both channels are closed once monitoring stops, which happens once the
+// context is cancelled, or if something goes wrong, in which case the error
+// is sent on the error channel before it's closed. Cancelling the context
+// isn't considered an error. The trigger is closed and the goroutine exits
+// once the context is cancelled, even if nobody is reading the channels.
+func MonitorChan(ctx context.Context, config Config) (<-chan Event, <-chan error) {
+	events := make(chan Event)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(events)
+		defer close(errs)
+
+		err := MonitorEventsContext(ctx, config, func(event Event) error {
+			select {
+			case events <- event:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && err != ctx.Err() {
+			errs <- err
+		}
+	}()
+
+	return events, errs
+}
+
+// vim: foldmethod=marker
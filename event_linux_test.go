@@ -0,0 +1,114 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+//go:build linux
+// +build linux
+
+package psi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestWaitForStall(t *testing.T) {
+	config := idleConfig(t)
+	// Setting up the trigger writes the trigger spec over the pressure
+	// file, so the pressure has to be put back before it's read.
+	poll = func(fds []unix.PollFd, timeout int) (int, error) {
+		fds[0].Revents = unix.POLLPRI
+		return 1, os.WriteFile(config.Path, []byte("some avg10=1.00 avg60=0.00 avg300=0.00 total=0\n"), 0o644)
+	}
+	defer func() { poll = unix.Poll }()
+
+	event, err := WaitForStall(context.Background(), config)
+	if err != nil {
+		t.Fatalf("WaitForStall() = %v", err)
+	}
+	if event.Seq != 1 || event.Pressure.Some.Avg10 != 1 {
+		t.Fatalf("WaitForStall() = %+v", event)
+	}
+}
+
+func TestWaitForStallTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := WaitForStall(ctx, idleConfig(t))
+	if err != ErrTimeout {
+		t.Fatalf("WaitForStall() = %v, want ErrTimeout", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("ErrTimeout doesn't match context.DeadlineExceeded")
+	}
+}
+
+func TestWaitForStallOnTick(t *testing.T) {
+	config := idleConfig(t)
+	config.PollTimeout = 10 * time.Millisecond
+	config.OnTick = func() error { return ErrStopMonitoring }
+
+	if _, err := WaitForStall(context.Background(), config); err != ErrNoStall {
+		t.Fatalf("WaitForStall() = %v, want ErrNoStall", err)
+	}
+}
+
+func TestMonitorMemoryFull(t *testing.T) {
+	const contents = "some avg10=20.00 avg60=10.00 avg300=5.00 total=1000\n" +
+		"full avg10=12.50 avg60=6.00 avg300=2.00 total=500\n"
+	pressureFixtures(t, map[Resource]string{ResourceMemory: contents})
+	// As with TestWaitForStall, the trigger spec is written over the
+	// fixture, so put it back before it's read.
+	poll = func(fds []unix.PollFd, timeout int) (int, error) {
+		fds[0].Revents = unix.POLLPRI
+		return 1, os.WriteFile(filepath.Join(pressureRoot, "memory"), []byte(contents), 0o644)
+	}
+	defer func() { poll = unix.Poll }()
+
+	var got Event
+	err := MonitorMemoryFull(150*time.Millisecond, 2*time.Second, func(event Event) error {
+		got = event
+		return ErrStopMonitoring
+	})
+	if err != nil {
+		t.Fatalf("MonitorMemoryFull() = %v", err)
+	}
+
+	want := Config{
+		Resource:            ResourceMemory,
+		Type:                StallTypeFull,
+		StallWindowDuration: 150 * time.Millisecond,
+		WindowDuration:      2 * time.Second,
+	}
+	if !got.Config.Equal(want) {
+		t.Fatalf("Event.Config = %+v, want %+v", got.Config, want)
+	}
+	if got.Pressure.Full == nil || got.Pressure.Full.Avg10 != 12.5 {
+		t.Fatalf("Event.Pressure = %+v, want Full.Avg10 of 12.5", got.Pressure)
+	}
+}
+
+// vim: foldmethod=marker
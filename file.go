@@ -0,0 +1,52 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"context"
+	"os"
+)
+
+// ReadPressureFile will read the current backpressure from a pressure file
+// that's already open, such as one handed to a sandboxed process that can't
+// open /proc itself. The file offset doesn't matter, and isn't changed.
+func ReadPressureFile(f *os.File) (Pressure, error) {
+	return readPressureAt(f)
+}
+
+// MonitorFile is Monitor, but sets the trigger up on a pressure file that's
+// already open, rather than opening the one for the Config's Resource. The
+// Resource and CgroupPath are only used for logging and errors.
+//
+// The file has to have been opened O_RDWR|O_NONBLOCK, and have no trigger
+// on it already. It's closed when MonitorFile returns. Since there's no
+// opening it again, the trigger is never reopened, whatever ReopenAttempts
+// is.
+func MonitorFile(f *os.File, config Config, cb MonitorCallback) error {
+	trigger, err := NewTriggerFromSource(config, f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return run(context.Background(), trigger, func(*Trigger, wakeup) error { return cb() })
+}
+
+// vim: foldmethod=marker
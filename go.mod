@@ -1,5 +1,5 @@
 module pault.ag/go/psi
 
-go 1.13
+go 1.20
 
-require golang.org/x/sys v0.0.0-20200113162924-86b910548bc1
+require golang.org/x/sys v0.22.0
@@ -0,0 +1,152 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Group runs a bunch of monitors, each with its own Config and callback, in
+// their own goroutines, and stops and waits on them together. The zero value
+// is an empty Group, ready to have monitors added to it.
+type Group struct {
+	// CancelOnError, if set, will stop every monitor in the Group as soon
+	// as any one of them returns an error.
+	CancelOnError bool
+
+	mu        sync.Mutex
+	monitors  []groupMonitor
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	errs      []error
+	closeOnce sync.Once
+}
+
+// groupMonitor is a monitor that's been added to a Group.
+type groupMonitor struct {
+	config Config
+	cb     MonitorCallback
+	stats  *monitorStats
+}
+
+// ErrGroupStarted is returned by Group.Add and Group.Start once the Group has
+// been started, since there's no adding monitors to it after that.
+var ErrGroupStarted error = fmt.Errorf("psi: group already started")
+
+// Add will add a monitor to the Group, which is started along with the rest
+// of them by Start. Once the Group has been started, ErrGroupStarted is
+// returned, and the monitor isn't added.
+func (g *Group) Add(config Config, cb MonitorCallback) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.cancel != nil {
+		return ErrGroupStarted
+	}
+	stats := &monitorStats{}
+	config.stats = stats
+	g.monitors = append(g.monitors, groupMonitor{config: config, cb: cb, stats: stats})
+	return nil
+}
+
+// Start will Check every Config in the Group, and if they're all fine, start
+// each monitor in its own goroutine. The monitors run until they return, the
+// provided context is cancelled, or Close is called.
+func (g *Group) Start(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.cancel != nil {
+		return ErrGroupStarted
+	}
+	for _, monitor := range g.monitors {
+		if err := monitor.config.Check(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	g.cancel = cancel
+	for _, monitor := range g.monitors {
+		g.wg.Add(1)
+		go func(monitor groupMonitor) {
+			defer g.wg.Done()
+			err := MonitorContext(ctx, monitor.config, monitor.cb)
+			if err == nil || err == ctx.Err() {
+				// Stopping the Group isn't an error.
+				return
+			}
+			g.mu.Lock()
+			g.errs = append(g.errs, err)
+			g.mu.Unlock()
+			if g.CancelOnError {
+				cancel()
+			}
+		}(monitor)
+	}
+	return nil
+}
+
+// Stats will return the counters of each monitor in the Group, as they are
+// right now, in the order they were added. This is safe to call while the
+// monitors are running.
+func (g *Group) Stats() []Stats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stats := make([]Stats, len(g.monitors))
+	for i, monitor := range g.monitors {
+		stats[i] = monitor.stats.snapshot()
+	}
+	return stats
+}
+
+// Wait will block until every monitor in the Group has returned, and return
+// all of their errors joined together with errors.Join. Monitors that were
+// stopped by the context, Close, or CancelOnError don't count as errors.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.cancel != nil {
+		g.cancel()
+	}
+	return errors.Join(g.errs...)
+}
+
+// Close will stop every monitor in the Group, and then Wait on them. Calling
+// Close again does nothing, and returns nil.
+func (g *Group) Close() error {
+	var err error
+	g.closeOnce.Do(func() {
+		g.mu.Lock()
+		if g.cancel != nil {
+			g.cancel()
+		}
+		g.mu.Unlock()
+		err = g.Wait()
+	})
+	return err
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,49 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGroupAddAfterStart(t *testing.T) {
+	var group Group
+	if err := group.Add(idleConfig(t), func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := group.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer group.Close()
+
+	if err := group.Add(idleConfig(t), func() error { return nil }); err != ErrGroupStarted {
+		t.Fatalf("Add() after Start = %v, want ErrGroupStarted", err)
+	}
+	if stats := group.Stats(); len(stats) != 1 {
+		t.Fatalf("Stats() has %d monitors, want 1", len(stats))
+	}
+	if err := group.Start(context.Background()); err != ErrGroupStarted {
+		t.Fatalf("Start() again = %v, want ErrGroupStarted", err)
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,103 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"context"
+)
+
+// Handle is a Monitor running in the background, which may be stopped from
+// another goroutine.
+type Handle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+	stats  monitorStats
+}
+
+// Start will register the trigger described by the Config, and then invoke
+// the provided Callback from a new goroutine every time the backpressure
+// thresholds exceed the provided configuration, until either the Callback
+// returns an error or Stop is called.
+//
+// Errors setting up the trigger are returned right away, rather than from
+// Wait or Stop.
+func Start(config Config, cb MonitorCallback) (*Handle, error) {
+	if err := config.Check(); err != nil {
+		return nil, err
+	}
+
+	trigger, err := openTrigger(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &Handle{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	trigger.config.stats = &h.stats
+	go func() {
+		defer close(h.done)
+		defer cancel()
+		err := run(ctx, trigger, func(*Trigger, wakeup) error { return cb() })
+		if err != nil && err == ctx.Err() {
+			// We only get here from Stop, which isn't an error.
+			err = nil
+		}
+		h.err = err
+	}()
+	return h, nil
+}
+
+// Stop will tear down the Monitor without waiting for the next stall, and
+// return once the trigger has been closed. The returned error is the same as
+// would be returned from Wait. Stop may be called more than once, and from
+// more than one goroutine.
+func (h *Handle) Stop() error {
+	h.cancel()
+	return h.Wait()
+}
+
+// Unregister is Stop, for when what matters is that everything is released:
+// once it returns, the trigger's fd has been closed (which is what
+// unregisters the trigger with the kernel), and every goroutine the Monitor
+// started has exited. Like Stop, it may be called more than once.
+func (h *Handle) Unregister() error {
+	return h.Stop()
+}
+
+// Stats will return the Monitor's counters as they are right now. This is
+// safe to call while the Monitor is running, and after it's stopped.
+func (h *Handle) Stats() Stats {
+	return h.stats.snapshot()
+}
+
+// Wait will block until the Monitor exits, and return the error that caused
+// it to exit. ErrStopMonitoring returned from the Callback and calls to Stop
+// both result in a nil error.
+func (h *Handle) Wait() error {
+	<-h.done
+	return h.err
+}
+
+// vim: foldmethod=marker
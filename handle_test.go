@@ -0,0 +1,68 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// idleConfig will return a Config for a pressure file that's just a regular
+// file, which never reports an event, so it's as idle as a Resource gets.
+func idleConfig(t *testing.T) Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "memory")
+	if err := os.WriteFile(path, []byte("some avg10=0.00 avg60=0.00 avg300=0.00 total=0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return Config{
+		Path:                path,
+		Type:                StallTypeSome,
+		StallWindowDuration: 100 * time.Millisecond,
+		WindowDuration:      time.Second,
+	}
+}
+
+func TestHandleStop(t *testing.T) {
+	h, err := Start(idleConfig(t), func() error {
+		t.Error("callback invoked on an idle resource")
+		return nil
+	})
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if err := h.Stop(); err != nil {
+		t.Fatalf("Stop() = %v", err)
+	}
+	if took := time.Since(start); took > 100*time.Millisecond {
+		t.Fatalf("Stop took %s", took)
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,105 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+// Package clock is where psi gets the time from, so that the helpers built
+// on timing (Throttle, MovingAverage, PollMonitor and so on) can be tested
+// without waiting around. It's internal so that the only way to swap it out
+// is psitest.Clock.
+package clock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock is the parts of the time package psi uses.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is a time.Ticker, from a Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// box is here because an atomic.Value can't hold Clocks of different types.
+type box struct{ clock Clock }
+
+var current atomic.Pointer[box]
+
+func init() {
+	current.Store(&box{Real{}})
+}
+
+// Get will return the Clock currently in use.
+func Get() Clock {
+	return current.Load().clock
+}
+
+// Set will swap out the Clock in use, returning a func that puts back the
+// one from before.
+func Set(clock Clock) func() {
+	prev := current.Swap(&box{clock})
+	return func() { current.Store(prev) }
+}
+
+// Now will return the time according to the Clock in use.
+func Now() time.Time {
+	return Get().Now()
+}
+
+// Since will return how long it's been since t, according to the Clock in
+// use.
+func Since(t time.Time) time.Duration {
+	return Get().Now().Sub(t)
+}
+
+// After is time.After, from the Clock in use.
+func After(d time.Duration) <-chan time.Time {
+	return Get().After(d)
+}
+
+// NewTicker is time.NewTicker, from the Clock in use.
+func NewTicker(d time.Duration) Ticker {
+	return Get().NewTicker(d)
+}
+
+// Real is the Clock from the time package.
+type Real struct{}
+
+// Now is time.Now.
+func (Real) Now() time.Time { return time.Now() }
+
+// After is time.After.
+func (Real) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// NewTicker is time.NewTicker.
+func (Real) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+// realTicker is a time.Ticker that's a Ticker.
+type realTicker struct{ ticker *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.ticker.C }
+func (t realTicker) Stop()               { t.ticker.Stop() }
+
+// vim: foldmethod=marker
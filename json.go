@@ -0,0 +1,181 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// UnmarshalText will set the Resource from its name, returning an error if
+// it's not one we know about, so that typos in config files are caught when
+// they're decoded. An empty name is fine, since a Config with a Path doesn't
+// need a Resource; Check still catches one that does.
+func (r *Resource) UnmarshalText(text []byte) error {
+	resource := Resource(text)
+	switch resource {
+	case "", ResourceCPU, ResourceIO, ResourceMemory:
+	default:
+		return fmt.Errorf("psi: unknown Resource %q", text)
+	}
+	*r = resource
+	return nil
+}
+
+// UnmarshalText will set the StallType from its name, returning an error if
+// it's not "some" or "full". An empty StallType is let through, as it is in a
+// zero Config, and left for Check to complain about.
+func (t *StallType) UnmarshalText(text []byte) error {
+	stallType := StallType(text)
+	switch stallType {
+	case "", StallTypeSome, StallTypeFull:
+	default:
+		return fmt.Errorf("psi: unknown StallType %q", text)
+	}
+	*t = stallType
+	return nil
+}
+
+// MarshalText will encode the TriggerTerminator as its String.
+func (t TriggerTerminator) MarshalText() ([]byte, error) {
+	switch t {
+	case TerminatorNUL, TerminatorNewline:
+		return []byte(t.String()), nil
+	}
+	return nil, fmt.Errorf("psi: unknown TriggerTerminator %d", int(t))
+}
+
+// UnmarshalText will set the TriggerTerminator from its name, "nul" or
+// "newline".
+func (t *TriggerTerminator) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "nul":
+		*t = TerminatorNUL
+	case "newline":
+		*t = TerminatorNewline
+	default:
+		return fmt.Errorf("psi: unknown TriggerTerminator %q", text)
+	}
+	return nil
+}
+
+// duration is a time.Duration that's encoded as a string, like "100ms",
+// rather than a number of nanoseconds.
+type duration time.Duration
+
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("psi: %w", err)
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// configJSON is the parts of a Config that make sense in a config file,
+// which is everything but the hooks and the Logger.
+type configJSON struct {
+	Resource            Resource  `json:"resource,omitempty"`
+	Type                StallType `json:"type,omitempty"`
+	StallWindowDuration duration  `json:"stall_window"`
+	WindowDuration      duration  `json:"window"`
+	MinCallbackInterval duration  `json:"min_callback_interval,omitempty"`
+	PollTimeout         duration  `json:"poll_timeout,omitempty"`
+	FireOnStart         bool      `json:"fire_on_start,omitempty"`
+	RecoverPanics       bool      `json:"recover_panics,omitempty"`
+	ContinueOnError     bool      `json:"continue_on_callback_error,omitempty"`
+	ReopenAttempts      int       `json:"reopen_attempts,omitempty"`
+	ReopenBackoff       duration  `json:"reopen_backoff,omitempty"`
+	CgroupPath          string    `json:"cgroup_path,omitempty"`
+	CgroupRoot          string    `json:"cgroup_root,omitempty"`
+	Path                string    `json:"path,omitempty"`
+
+	TriggerTerminator TriggerTerminator `json:"trigger_terminator,omitempty"`
+	LockThread        bool              `json:"lock_thread,omitempty"`
+}
+
+// MarshalJSON will encode the Config with its durations as strings, such as:
+//
+//	{"resource": "memory", "type": "some", "stall_window": "150ms", "window": "1s"}
+//
+// The hooks (OnTick, OnCallbackDuration) and Logger can't be encoded, and are
+// left out.
+func (c Config) MarshalJSON() ([]byte, error) {
+	return json.Marshal(configJSON{
+		Resource:            c.Resource,
+		Type:                c.Type,
+		StallWindowDuration: duration(c.StallWindowDuration),
+		WindowDuration:      duration(c.WindowDuration),
+		MinCallbackInterval: duration(c.MinCallbackInterval),
+		PollTimeout:         duration(c.PollTimeout),
+		FireOnStart:         c.FireOnStart,
+		RecoverPanics:       c.RecoverPanics,
+		ContinueOnError:     c.ContinueOnCallbackError,
+		ReopenAttempts:      c.ReopenAttempts,
+		ReopenBackoff:       duration(c.ReopenBackoff),
+		CgroupPath:          c.CgroupPath,
+		CgroupRoot:          c.CgroupRoot,
+		Path:                c.Path,
+		TriggerTerminator:   c.TriggerTerminator,
+		LockThread:          c.LockThread,
+	})
+}
+
+// UnmarshalJSON will decode a Config encoded by MarshalJSON. Unknown
+// Resources and StallTypes, unparsable durations, and unknown fields are all
+// errors. The hooks and Logger are left as they were, so they can be set up
+// before decoding into the Config.
+//
+// This doesn't Check the Config; that still happens when it's used.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	var wire configJSON
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&wire); err != nil {
+		return err
+	}
+
+	c.Resource = wire.Resource
+	c.Type = wire.Type
+	c.StallWindowDuration = time.Duration(wire.StallWindowDuration)
+	c.WindowDuration = time.Duration(wire.WindowDuration)
+	c.MinCallbackInterval = time.Duration(wire.MinCallbackInterval)
+	c.PollTimeout = time.Duration(wire.PollTimeout)
+	c.FireOnStart = wire.FireOnStart
+	c.RecoverPanics = wire.RecoverPanics
+	c.ContinueOnCallbackError = wire.ContinueOnError
+	c.ReopenAttempts = wire.ReopenAttempts
+	c.ReopenBackoff = time.Duration(wire.ReopenBackoff)
+	c.CgroupPath = wire.CgroupPath
+	c.CgroupRoot = wire.CgroupRoot
+	c.Path = wire.Path
+	c.TriggerTerminator = wire.TriggerTerminator
+	c.LockThread = wire.LockThread
+	return nil
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,126 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigJSON(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config Config
+		json   string
+	}{
+		{
+			name:   "zero",
+			config: Config{},
+			json:   `{"stall_window":"0s","window":"0s"}`,
+		},
+		{
+			name: "minimal",
+			config: Config{
+				Resource:            ResourceMemory,
+				Type:                StallTypeSome,
+				StallWindowDuration: 150 * time.Millisecond,
+				WindowDuration:      time.Second,
+			},
+			json: `{"resource":"memory","type":"some","stall_window":"150ms","window":"1s"}`,
+		},
+		{
+			name: "path only",
+			config: Config{
+				Type:                StallTypeFull,
+				StallWindowDuration: 100 * time.Millisecond,
+				WindowDuration:      2 * time.Second,
+				Path:                "/run/pressure/io",
+			},
+			json: `{"type":"full","stall_window":"100ms","window":"2s","path":"/run/pressure/io"}`,
+		},
+		{
+			name: "everything",
+			config: Config{
+				Resource:                ResourceIO,
+				Type:                    StallTypeFull,
+				StallWindowDuration:     100 * time.Millisecond,
+				WindowDuration:          2 * time.Second,
+				MinCallbackInterval:     5 * time.Second,
+				PollTimeout:             time.Minute,
+				FireOnStart:             true,
+				RecoverPanics:           true,
+				ContinueOnCallbackError: true,
+				ReopenAttempts:          3,
+				ReopenBackoff:           time.Second,
+				CgroupPath:              "system.slice",
+				CgroupRoot:              "/mnt/cgroup2",
+				TriggerTerminator:       TerminatorNewline,
+				LockThread:              true,
+			},
+			json: `{"resource":"io","type":"full","stall_window":"100ms","window":"2s",` +
+				`"min_callback_interval":"5s","poll_timeout":"1m0s","fire_on_start":true,` +
+				`"recover_panics":true,"continue_on_callback_error":true,"reopen_attempts":3,` +
+				`"reopen_backoff":"1s","cgroup_path":"system.slice","cgroup_root":"/mnt/cgroup2",` +
+				`"trigger_terminator":"newline","lock_thread":true}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.json {
+				t.Fatalf("Marshal() = %s, want %s", data, test.json)
+			}
+
+			var config Config
+			if err := json.Unmarshal(data, &config); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(config, test.config) {
+				t.Fatalf("round trip = %+v, want %+v", config, test.config)
+			}
+		})
+	}
+}
+
+func TestConfigJSONInvalid(t *testing.T) {
+	for _, data := range []string{
+		`{"resource":"disk","type":"some","stall_window":"150ms","window":"1s"}`,
+		`{"resource":"memory","type":"most","stall_window":"150ms","window":"1s"}`,
+		`{"resource":"memory","type":"some","stall_window":"150","window":"1s"}`,
+		`{"resource":"memory","type":"some","stall_window":"150ms","window":"1s","trigger_terminator":"crlf"}`,
+		`{"resource":"memory","type":"some","stall_window":"150ms","window":"1s","windw":"2s"}`,
+	} {
+		var config Config
+		if err := json.Unmarshal([]byte(data), &config); err == nil {
+			t.Errorf("Unmarshal(%s) didn't fail", data)
+		}
+	}
+
+	if _, err := json.Marshal(Config{TriggerTerminator: 7}); err == nil {
+		t.Error("Marshal() of an unknown TriggerTerminator didn't fail")
+	}
+}
+
+// vim: foldmethod=marker
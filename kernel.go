@@ -0,0 +1,84 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KernelSupportsTriggers will return true if the running kernel is new
+// enough to set up PSI triggers, which was added in Linux 5.2. PSI itself
+// was added in 4.20, so kernels in between can read pressure, but not
+// monitor it.
+//
+// This only looks at the kernel version, so it's no guarantee: distribution
+// kernels may have triggers backported, and newer kernels may have PSI
+// turned off. Use ProbeStatus and Probe to find out about those.
+func KernelSupportsTriggers() (bool, error) {
+	release, err := kernelRelease()
+	if err != nil {
+		return false, err
+	}
+	major, minor, err := parseKernelRelease(release)
+	if err != nil {
+		return false, err
+	}
+	return major > 5 || (major == 5 && minor >= 2), nil
+}
+
+// parseKernelRelease will pull the major and minor version out of a kernel
+// release, such as "5.15.0-91-generic".
+func parseKernelRelease(release string) (int, int, error) {
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("psi: can't parse kernel release %q", release)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("psi: can't parse kernel release %q", release)
+	}
+	// The minor version may run right into the rest, as in "5.2-rc1".
+	minor := parts[1]
+	if i := strings.IndexFunc(minor, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		minor = minor[:i]
+	}
+	minorVersion, err := strconv.Atoi(minor)
+	if err != nil {
+		return 0, 0, fmt.Errorf("psi: can't parse kernel release %q", release)
+	}
+	return major, minorVersion, nil
+}
+
+// checkTriggerError will turn an error setting up a trigger into
+// ErrTriggerUnsupported, if the kernel is too old to have triggers at all,
+// since that's a lot more useful than whatever the kernel said. Whatever the
+// kernel said is still wrapped, so errors.Is and errors.As see it.
+func checkTriggerError(err error) error {
+	if ok, kerr := KernelSupportsTriggers(); kerr == nil && !ok {
+		release, _ := kernelRelease()
+		return fmt.Errorf("%w (Linux %s is older than 5.2): %w", ErrTriggerUnsupported, release, err)
+	}
+	return err
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,111 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+// Level is a rough bucket of how bad pressure is, for when a traffic light
+// is more useful than a handful of floats.
+type Level int
+
+const (
+	// LevelNone means there's no pressure to speak of.
+	LevelNone Level = iota
+
+	// LevelLow means there's some pressure, but nothing to worry about.
+	LevelLow
+
+	// LevelMedium means the pressure is worth keeping an eye on.
+	LevelMedium
+
+	// LevelHigh means the pressure is slowing things down noticeably.
+	LevelHigh
+
+	// LevelCritical means work is stalled for a good chunk of the time.
+	LevelCritical
+)
+
+// String will return the name of the Level, such as "medium".
+func (l Level) String() string {
+	switch l {
+	case LevelNone:
+		return "none"
+	case LevelLow:
+		return "low"
+	case LevelMedium:
+		return "medium"
+	case LevelHigh:
+		return "high"
+	case LevelCritical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+// Classifier sorts PressureMetrics into Levels by their Avg10, which is the
+// percentage of the last 10 seconds spent stalled. Each field is the lowest
+// Avg10 for that Level; anything under Low is LevelNone. They're expected to
+// go up in order. The zero Classifier calls everything LevelCritical, so
+// start from a copy of DefaultClassifier to change some of them.
+type Classifier struct {
+	Low      float64
+	Medium   float64
+	High     float64
+	Critical float64
+}
+
+// DefaultClassifier is the Classifier used by PressureMetrics.Level. The
+// thresholds are meant for memory "some" pressure, where even a few percent
+// means tasks are waiting on reclaim, and a quarter of the time means the
+// system is thrashing. Other Resources (CPU "some", in particular, which is
+// rarely zero on a busy machine) may want their own Classifier.
+var DefaultClassifier = Classifier{
+	Low:      1,
+	Medium:   10,
+	High:     25,
+	Critical: 50,
+}
+
+// Level will return the Level for the provided PressureMetrics.
+// Unavailable PressureMetrics (as reported when PSI is disabled) are
+// LevelNone.
+func (c Classifier) Level(m PressureMetrics) Level {
+	avg := m.Avg10
+	switch {
+	case m.Unavailable:
+		return LevelNone
+	case avg >= c.Critical:
+		return LevelCritical
+	case avg >= c.High:
+		return LevelHigh
+	case avg >= c.Medium:
+		return LevelMedium
+	case avg >= c.Low:
+		return LevelLow
+	}
+	return LevelNone
+}
+
+// Level will return the Level of the PressureMetrics, according to the
+// DefaultClassifier.
+func (m PressureMetrics) Level() Level {
+	return DefaultClassifier.Level(m)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,158 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"syscall"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// run will watch a Trigger, invoking the callback with it every time it
+// trips (and once before that, with the wakeup marked initial, if the
+// Config asks for FireOnStart), until the callback returns an error or the
+// context is cancelled. If the Trigger's Config asks for it, the Trigger
+// will be reopened when the kernel reports an error on it, in which case the
+// callback is invoked with the new one.
+//
+// The Trigger is closed when run returns.
+func run(ctx context.Context, trigger *Trigger, cb func(*Trigger, wakeup) error) (err error) {
+	config := trigger.config
+	defer func() {
+		// If reopening failed, there's no trigger left to close.
+		if trigger != nil {
+			trigger.Close()
+		}
+		config.logger().Debug("psi: trigger closed", config.logArgs("err", err)...)
+	}()
+
+	if config.LockThread {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+	}
+
+	var wake wakeup
+	fire, fireInitial := config.wrapCallback(func() error {
+		return wake.deliver(func() error { return cb(trigger, wake) })
+	})
+	if config.FireOnStart {
+		wake.initial = true
+		err = fireInitial()
+		wake.initial = false
+		if err != nil {
+			if err == ErrStopMonitoring {
+				return nil
+			}
+			return err
+		}
+	}
+
+	attempts := 0
+	for {
+		err = watch(ctx, []*Trigger{trigger}, config.PollTimeout, config.OnTick, func(int) error {
+			attempts = 0
+			wake.seq++
+			return fire()
+		})
+		if !reopenable(err) || trigger.fromSource {
+			return err
+		}
+
+		for {
+			if attempts >= config.ReopenAttempts {
+				if attempts == 0 {
+					return err
+				}
+				return fmt.Errorf("psi: gave up reopening the trigger after %d attempts: %w", attempts, err)
+			}
+			attempts++
+			config.logger().Warn(
+				"psi: reopening trigger",
+				config.logArgs("attempt", attempts, "err", err)...,
+			)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-clock.After(config.ReopenBackoff * time.Duration(attempts)):
+			}
+
+			if trigger != nil {
+				trigger.Close()
+			}
+			trigger, err = openTrigger(config)
+			if err == nil {
+				break
+			}
+		}
+	}
+}
+
+// wakeup is what run tells its callback about why it was invoked.
+type wakeup struct {
+	// initial is set for the call made because of Config.FireOnStart.
+	initial bool
+
+	// seq is how many times the trigger has fired, including this time.
+	seq uint64
+
+	// dropped is how many times the trigger fired without the callback
+	// being invoked, between the last time it was and this one.
+	dropped uint64
+
+	// delivered is the seq of the last wakeup the callback was invoked for.
+	delivered uint64
+}
+
+// deliver will work out how many wakeups were dropped since the last one
+// the callback took, and invoke it, once the rate limiting has let it
+// through. If the callback drops the wakeup itself (returning ErrDropped, as
+// Throttle does), it's counted as dropped for next time. The initial wakeup
+// doesn't come from the trigger, so doesn't count.
+func (w *wakeup) deliver(cb func() error) error {
+	if w.initial {
+		w.dropped = 0
+		return cb()
+	}
+	delivered := w.delivered
+	w.dropped = w.seq - w.delivered - 1
+	w.delivered = w.seq
+	err := cb()
+	if err == ErrDropped {
+		w.delivered = delivered
+	}
+	return err
+}
+
+// reopenable will return true if the error from watch means the trigger has
+// gone bad, and is worth reopening.
+func reopenable(err error) bool {
+	return errors.Is(err, ErrTriggerFailed) ||
+		errors.Is(err, ErrTriggerClosed) ||
+		errors.Is(err, syscall.EBADF)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,144 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+//go:build linux
+// +build linux
+
+package psi_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pault.ag/go/psi"
+	"pault.ag/go/psi/psitest"
+)
+
+// testConfig is a Config that passes Check, for Triggers on a Source.
+var testConfig = psi.Config{
+	Resource:            psi.ResourceMemory,
+	Type:                psi.StallTypeSome,
+	StallWindowDuration: 100 * time.Millisecond,
+	WindowDuration:      time.Second,
+}
+
+// startTrigger will set up a Trigger for the Config on a new Source, and
+// monitor it in the background until the test is over, sending each Event
+// on the returned channel.
+func startTrigger(t *testing.T, config psi.Config) (*psitest.Source, <-chan psi.Event) {
+	t.Helper()
+	events := make(chan psi.Event, 16)
+	source := startTriggerFunc(t, config, func(event psi.Event) error {
+		events <- event
+		return nil
+	})
+	return source, events
+}
+
+// startTriggerFunc is startTrigger, but with the EventCallback to invoke,
+// rather than a channel of Events. The monitor has returned by the time the
+// test is over.
+func startTriggerFunc(t *testing.T, config psi.Config, cb psi.EventCallback) *psitest.Source {
+	t.Helper()
+	source, err := psitest.NewSource(psitest.FakeSomePressure(psi.PressureMetrics{Avg10: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trigger, err := psi.NewTriggerFromSource(config, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		psi.MonitorTrigger(ctx, trigger, cb)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return source
+}
+
+// nextEvent will wait for an Event, failing the test if there isn't one.
+func nextEvent(t *testing.T, events <-chan psi.Event) psi.Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no Event")
+	}
+	return psi.Event{}
+}
+
+func TestFireOnStartNotRateLimited(t *testing.T) {
+	config := testConfig
+	config.FireOnStart = true
+	config.MinCallbackInterval = time.Hour
+	source, events := startTrigger(t, config)
+
+	if event := nextEvent(t, events); !event.Initial {
+		t.Fatalf("first Event isn't Initial: %+v", event)
+	}
+	if err := source.Fire(); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, events); event.Initial || event.Seq != 1 {
+		t.Fatalf("Event after firing = %+v, want Seq 1", event)
+	}
+}
+
+func TestEventDroppedByCallback(t *testing.T) {
+	seen := make(chan uint64, 3)
+	events := make(chan psi.Event, 1)
+	source := startTriggerFunc(t, testConfig, func(event psi.Event) error {
+		seen <- event.Seq
+		if event.Seq < 3 {
+			return psi.ErrDropped
+		}
+		events <- event
+		return nil
+	})
+
+	for i := 1; i <= 3; i++ {
+		if err := source.Fire(); err != nil {
+			t.Fatal(err)
+		}
+		// Wait for each one to be seen on its own before the next, or
+		// the Source may fold them into one.
+		select {
+		case seq := <-seen:
+			if seq != uint64(i) {
+				t.Fatalf("callback saw Seq %d, want %d", seq, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d never reached the callback", i)
+		}
+	}
+	if event := nextEvent(t, events); event.Seq != 3 || event.Dropped != 2 {
+		t.Fatalf("Event = %+v, want Seq 3 with 2 dropped", event)
+	}
+}
+
+// vim: foldmethod=marker
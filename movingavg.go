@@ -0,0 +1,199 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// MovingAverage keeps a moving average of the "some" pressure on a Resource
+// over a window of your choosing, worked out from the Total counter, rather
+// than being stuck with the kernel's 10, 60 and 300 second averages. A 5
+// second window notices a stall a good bit sooner than Avg10 does.
+type MovingAverage struct {
+	window time.Duration
+	fd     *os.File
+
+	mu      sync.Mutex
+	samples []movingSample
+	err     error
+
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// movingSample is a single read of the Total counter.
+type movingSample struct {
+	time  time.Time
+	total uint64
+}
+
+// NewMovingAverage will start sampling the pressure on the provided Resource
+// every sampleInterval, averaging over the last window. The window needs to
+// be at least as long as the sampleInterval, and a few times longer is
+// better, since the average only moves once per sample. Sampling stops once
+// the MovingAverage is closed.
+func NewMovingAverage(resource Resource, window, sampleInterval time.Duration) (*MovingAverage, error) {
+	return NewMovingAverageContext(context.Background(), resource, window, sampleInterval)
+}
+
+// NewMovingAverageContext is NewMovingAverage, but sampling also stops once
+// the context is done. The MovingAverage still needs to be closed.
+func NewMovingAverageContext(
+	ctx context.Context,
+	resource Resource,
+	window, sampleInterval time.Duration,
+) (*MovingAverage, error) {
+	if sampleInterval <= 0 {
+		return nil, fmt.Errorf("psi: moving average sample interval must be more than 0, not %s", sampleInterval)
+	}
+	if window < sampleInterval {
+		return nil, fmt.Errorf("psi: moving average window %s is shorter than the sample interval %s", window, sampleInterval)
+	}
+
+	config := Config{Resource: resource}
+	fd, err := config.open(os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	m := &MovingAverage{
+		window: window,
+		fd:     fd,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	// Take the first sample here, so that anything wrong with reading the
+	// file comes back from the constructor, not later on from Err.
+	if err := m.sample(); err != nil {
+		cancel()
+		fd.Close()
+		return nil, err
+	}
+	go m.run(ctx, sampleInterval)
+	return m, nil
+}
+
+// run will sample the pressure every interval until the context is done.
+func (m *MovingAverage) run(ctx context.Context, interval time.Duration) {
+	defer close(m.done)
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			m.sample()
+		}
+	}
+}
+
+// sample will read the Total, and drop any samples that have fallen out of
+// the window. One sample from before the window is kept, so that the average
+// covers the whole window, rather than just the samples inside it.
+func (m *MovingAverage) sample() error {
+	now := clock.Now()
+	pressure, err := readPressureAt(m.fd)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+	if err != nil {
+		return err
+	}
+	if pressure.Some.Unavailable {
+		// A Total of 0 would look like the counter was reset.
+		return nil
+	}
+	m.samples = append(m.samples, movingSample{time: now, total: pressure.Some.Total})
+
+	cutoff := now.Add(-m.window)
+	drop := 0
+	for drop+1 < len(m.samples) && !m.samples[drop+1].time.After(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		m.samples = append(m.samples[:0], m.samples[drop:]...)
+	}
+	return nil
+}
+
+// Value will return the percentage of the window at least one task spent
+// stalled, from 0 to 100, the same as the kernel's averages. Until there
+// are two samples, which takes one sampleInterval, this is 0.
+//
+// Once the MovingAverage has been running for a whole window, this covers
+// the last window (give or take a sampleInterval); before that, it covers
+// however long it's been running. The Total counter going backwards (such as
+// when a cgroup is recreated) is treated as a reset.
+func (m *MovingAverage) Value() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.samples) < 2 {
+		return 0
+	}
+	var stalled uint64
+	for i := 1; i < len(m.samples); i++ {
+		stalled += deltaTotal(m.samples[i-1].total, m.samples[i].total)
+	}
+	elapsed := m.samples[len(m.samples)-1].time.Sub(m.samples[0].time)
+	if elapsed <= 0 {
+		return 0
+	}
+	value := 100 * float64(time.Duration(stalled)*time.Microsecond) / float64(elapsed)
+	if value > 100 {
+		// The counter and our clock don't tick quite together.
+		value = 100
+	}
+	return value
+}
+
+// Err will return the error from the most recent sample, if it failed. The
+// MovingAverage keeps sampling after an error, and Value carries on with the
+// samples it's got.
+func (m *MovingAverage) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// Close will stop sampling, and close the pressure file. Calling Close again
+// does nothing, and returns nil.
+func (m *MovingAverage) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		m.cancel()
+		<-m.done
+		err = m.fd.Close()
+	})
+	return err
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,92 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"time"
+)
+
+// Option changes the Config built by NewConfig.
+type Option func(*Config)
+
+// NewConfig will build a Config to monitor the provided Resource. Unless
+// changed by the provided Options, the Config will trigger when at least one
+// task is stalled (StallTypeSome) for 100ms within a 1s window.
+//
+// The Config isn't checked, so be sure to run `Check` on it if the Options
+// come from somewhere you don't trust.
+func NewConfig(resource Resource, opts ...Option) Config {
+	config := Config{
+		Resource:            resource,
+		Type:                StallTypeSome,
+		StallWindowDuration: time.Millisecond * 100,
+		WindowDuration:      time.Second,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.stallFraction != 0 {
+		config.StallWindowDuration = time.Duration(float64(config.WindowDuration) * config.stallFraction)
+		config.stallFraction = 0
+	}
+	return config
+}
+
+// WithStallType sets the Config's Type.
+func WithStallType(stallType StallType) Option {
+	return func(c *Config) {
+		c.Type = stallType
+	}
+}
+
+// WithStallWindow sets the Config's StallWindowDuration, which is how long
+// tasks need to be stalled for within the tracking window to trigger.
+func WithStallWindow(d time.Duration) Option {
+	return func(c *Config) {
+		c.StallWindowDuration = d
+		c.stallFraction = 0
+	}
+}
+
+// WithStallFraction sets the Config's StallWindowDuration to a fraction of
+// its WindowDuration, such as 0.1 to trigger when tasks are stalled for 10% of
+// the window. This is worked out once all the Options have been applied, so
+// it uses the final WindowDuration, whatever order the Options are in.
+// Whichever of WithStallFraction and WithStallWindow comes last wins.
+//
+// As with any StallWindowDuration, Check will return a *ConfigError if the
+// result is shorter than MinStallWindowDuration, or longer than the window
+// (or MaxStallWindowDuration).
+func WithStallFraction(f float64) Option {
+	return func(c *Config) {
+		c.stallFraction = f
+	}
+}
+
+// WithTrackingWindow sets the Config's WindowDuration, which is the window
+// stalls are measured within.
+func WithTrackingWindow(d time.Duration) Option {
+	return func(c *Config) {
+		c.WindowDuration = d
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,66 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi_test
+
+import (
+	"testing"
+	"time"
+
+	"pault.ag/go/psi"
+)
+
+func TestWithStallFraction(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		opts []psi.Option
+		want time.Duration
+	}{
+		{
+			name: "before window",
+			opts: []psi.Option{psi.WithStallFraction(0.1), psi.WithTrackingWindow(5 * time.Second)},
+			want: 500 * time.Millisecond,
+		},
+		{
+			name: "after window",
+			opts: []psi.Option{psi.WithTrackingWindow(5 * time.Second), psi.WithStallFraction(0.1)},
+			want: 500 * time.Millisecond,
+		},
+		{
+			name: "stall window last",
+			opts: []psi.Option{psi.WithStallFraction(0.1), psi.WithStallWindow(200 * time.Millisecond)},
+			want: 200 * time.Millisecond,
+		},
+		{
+			name: "fraction last",
+			opts: []psi.Option{psi.WithStallWindow(200 * time.Millisecond), psi.WithStallFraction(0.5)},
+			want: 500 * time.Millisecond,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := psi.NewConfig(psi.ResourceMemory, test.opts...)
+			if config.StallWindowDuration != test.want {
+				t.Fatalf("StallWindowDuration = %s, want %s", config.StallWindowDuration, test.want)
+			}
+		})
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,130 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// PollMonitor samples the pressure on a Resource at a fixed interval, and
+// invokes a callback when it crosses a threshold, for when the kernel's
+// triggers are too coarse, or for alerting on the kernel's decaying averages
+// rather than on stall windows.
+//
+// Callbacks are edge-triggered: OnRise is invoked once when the pressure goes
+// above the Threshold, and then not again until the pressure has dropped
+// below Threshold minus Hysteresis (at which point OnFall is invoked, if
+// set), so that pressure hovering right around the Threshold doesn't flap.
+type PollMonitor struct {
+	// Config is the Resource (and CgroupPath, if any) to sample. Only the
+	// Resource and CgroupPath are used, like Config.ReadPressure.
+	Config Config
+
+	// Interval is how often to sample the pressure, which has to be more
+	// than 0.
+	Interval time.Duration
+
+	// Value picks the number to compare to the Threshold out of the
+	// Pressure. If nil, this is Some.Avg10.
+	Value func(Pressure) float64
+
+	// Threshold is the value the pressure has to go above for OnRise to be
+	// invoked. For the averages, this is a percentage, from 0 to 100.
+	Threshold float64
+
+	// Hysteresis is how far below the Threshold the pressure has to drop
+	// before it's considered to have fallen.
+	Hysteresis float64
+
+	// OnRise is invoked when the pressure goes above the Threshold.
+	OnRise EventCallback
+
+	// OnFall, if not nil, is invoked when the pressure drops back below
+	// Threshold minus Hysteresis.
+	OnFall EventCallback
+}
+
+// value will return the number to compare to the Threshold.
+func (p PollMonitor) value(pressure Pressure) float64 {
+	if p.Value == nil {
+		return pressure.Some.Avg10
+	}
+	return p.Value(pressure)
+}
+
+// Run will sample the pressure every Interval, invoking the callbacks as the
+// pressure crosses the Threshold, until either a callback returns an error
+// or the provided context is cancelled. The first sample is taken right
+// away, and if the pressure is already above the Threshold, OnRise is
+// invoked for it.
+//
+// If a callback returns ErrStopMonitoring, Run will return nil. If the
+// context is cancelled, Run will return ctx.Err().
+func (p PollMonitor) Run(ctx context.Context) error {
+	if p.Interval <= 0 {
+		return fmt.Errorf("psi: poll monitor interval must be more than 0, not %s", p.Interval)
+	}
+
+	ticker := clock.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	above := false
+	for {
+		now := clock.Now()
+		pressure, err := p.Config.ReadPressure()
+		if err != nil {
+			return err
+		}
+		event := Event{Config: p.Config, Time: now, Pressure: pressure}
+
+		var cb EventCallback
+		switch value := p.value(pressure); {
+		case pressure.Some.Unavailable:
+			// Nothing to compare, so stay as we are.
+		case !above && value > p.Threshold:
+			above = true
+			cb = p.OnRise
+		case above && value < p.Threshold-p.Hysteresis:
+			above = false
+			cb = p.OnFall
+		}
+		if cb != nil {
+			if err := cb(event); err != nil {
+				if err == ErrStopMonitoring {
+					return nil
+				}
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C():
+		}
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,435 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// PressureMetrics are the numbers reported on a single line of a pressure
+// file, for one StallType.
+type PressureMetrics struct {
+	// Avg10, Avg60 and Avg300 are the percentage of wall time that tasks
+	// were stalled, averaged over the last 10, 60 and 300 seconds.
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+
+	// Total is the total time tasks were stalled, in microseconds. This is
+	// a counter that only ever goes up from when the system booted (or the
+	// cgroup was created), so the difference between two reads is how long
+	// tasks were stalled between them. Reboots and recreating the cgroup
+	// reset it to 0, which DeltaStall takes care of. When encoded as JSON,
+	// this is still a number of microseconds.
+	Total uint64 `json:"total"`
+
+	// Extra has any other numeric fields on the line, which this package
+	// doesn't know about, keyed by name, in case a newer kernel adds some.
+	// This is nil if there weren't any.
+	Extra map[string]float64 `json:"extra,omitempty"`
+
+	// Unavailable is set if the kernel didn't actually report numbers on
+	// the line. When PSI is disabled (or half-way there), some kernels
+	// fill the line with "nan" or "-" rather than leaving the file out,
+	// and rather than letting a NaN loose in everyone's math, those are
+	// parsed as 0, with Unavailable set. It's this way around so that
+	// PressureMetrics made by hand, or decoded from JSON written before
+	// this was here, count as real numbers.
+	Unavailable bool `json:"unavailable,omitempty"`
+}
+
+// Pressure is the current backpressure on a Resource, as reported by the
+// kernel.
+type Pressure struct {
+	// Some is the pressure where at least one task was stalled.
+	Some PressureMetrics `json:"some"`
+
+	// Full is the pressure where all tasks were stalled. This will be nil if
+	// the kernel didn't report a "full" line, which is the case for
+	// ResourceCPU on older kernels.
+	Full *PressureMetrics `json:"full,omitempty"`
+}
+
+// String will render the PressureMetrics the way they appear in a pressure
+// file, such as "avg10=0.12 avg60=0.05 avg300=0.01 total=1.2s", except that
+// the total is a time.Duration rather than microseconds.
+func (m PressureMetrics) String() string {
+	return string(m.appendTo(make([]byte, 0, 64)))
+}
+
+// EstimatedStalledCPUs will return a rough estimate of how many of numCPU
+// CPUs' worth of work was stalled over the last 10 seconds, which is Avg10
+// as a fraction, times numCPU. This is handy on capacity dashboards, next to
+// runtime.NumCPU().
+//
+// This is only an approximation, and a loose one: PSI tracks the time any
+// (for "some") or all (for "full") tasks were stalled, not how many were,
+// so 50% "some" could be one task stalled half the time, or dozens. Read it
+// as "how much of the machine was held up", not a count of runnable tasks,
+// and be careful comparing it across machines with different numCPU.
+func (m PressureMetrics) EstimatedStalledCPUs(numCPU int) float64 {
+	return m.Avg10 / 100 * float64(numCPU)
+}
+
+// appendTo will append the String form of the PressureMetrics to buf.
+func (m PressureMetrics) appendTo(buf []byte) []byte {
+	buf = append(buf, "avg10="...)
+	buf = strconv.AppendFloat(buf, m.Avg10, 'f', 2, 64)
+	buf = append(buf, " avg60="...)
+	buf = strconv.AppendFloat(buf, m.Avg60, 'f', 2, 64)
+	buf = append(buf, " avg300="...)
+	buf = strconv.AppendFloat(buf, m.Avg300, 'f', 2, 64)
+	buf = append(buf, " total="...)
+	return append(buf, (time.Duration(m.Total) * time.Microsecond).String()...)
+}
+
+// String will render the Pressure on one line, such as "some avg10=0.12
+// avg60=0.05 avg300=0.01 total=1.2s, full avg10=0.00 avg60=0.00 avg300=0.00
+// total=5ms". The "full" part is left off if there's no Full.
+func (p Pressure) String() string {
+	return string(p.appendTo(make([]byte, 0, 128)))
+}
+
+// appendTo will append the String form of the Pressure to buf.
+func (p Pressure) appendTo(buf []byte) []byte {
+	buf = append(buf, "some "...)
+	buf = p.Some.appendTo(buf)
+	if p.Full != nil {
+		buf = append(buf, ", full "...)
+		buf = p.Full.appendTo(buf)
+	}
+	return buf
+}
+
+// TotalStall will return the total time tasks were stalled for the provided
+// StallType, which is PressureMetrics.Total as a time.Duration. Like Total,
+// this is cumulative, and is meant to be subtracted from a later read to
+// work out how long tasks were stalled in between.
+//
+// If the StallType is StallTypeFull, but there's no "full" line, this will
+// return 0.
+func (p Pressure) TotalStall(t StallType) time.Duration {
+	switch t {
+	case StallTypeSome:
+		return time.Duration(p.Some.Total) * time.Microsecond
+	case StallTypeFull:
+		if p.Full != nil {
+			return time.Duration(p.Full.Total) * time.Microsecond
+		}
+	}
+	return 0
+}
+
+// DeltaStall will return how long at least one task was stalled between two
+// reads of the pressure on the same Resource, from the "some" Total.
+//
+// If the counter went backwards, it was reset (by a reboot, or by the cgroup
+// being recreated, for long-lived processes that keep reads around), so the
+// current Total is all the stall there's been since, and is returned as-is
+// rather than underflowing.
+func DeltaStall(prev, cur Pressure) time.Duration {
+	return time.Duration(deltaTotal(prev.Some.Total, cur.Some.Total)) * time.Microsecond
+}
+
+// deltaTotal will return how much a Total counter went up between two reads,
+// treating it going backwards as a reset.
+func deltaTotal(prev, cur uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+// ReadPressure will read the current backpressure on the provided Resource,
+// without setting up a trigger. This is handy to sample pressure on a timer
+// rather than waiting on events with Monitor.
+func ReadPressure(resource Resource) (Pressure, error) {
+	return Config{Resource: resource}.ReadPressure()
+}
+
+// ReadPressure will read the current backpressure on the Resource this
+// Config is for, including the CgroupPath (or Path) if one is set. The "some"
+// and "full" lines are both taken from a single read of the file. Only the
+// Resource, CgroupPath, CgroupRoot and Path are used; the Config doesn't need
+// to pass Check. If there's a CgroupPath, but no cgroup2 filesystem mounted at
+// the CgroupRoot, the returned error will match ErrCgroup2NotMounted.
+func (c Config) ReadPressure() (Pressure, error) {
+	if c.CgroupPath != "" && c.Path == "" {
+		if err := c.checkCgroup2(); err != nil {
+			return Pressure{}, err
+		}
+	}
+	fd, err := c.open(os.O_RDONLY)
+	if err != nil {
+		return Pressure{}, err
+	}
+	defer fd.Close()
+	return readPressureAt(fd)
+}
+
+// ReadPressureContext is ReadPressure, but gives up once the context is done,
+// returning ctx.Err(). Under enough memory pressure, even reading /proc can
+// stall, which is no good for an agent that can't afford to block.
+func ReadPressureContext(ctx context.Context, resource Resource) (Pressure, error) {
+	return Config{Resource: resource}.ReadPressureContext(ctx)
+}
+
+// ReadPressureContext is Config.ReadPressure, but gives up once the context
+// is done, returning ctx.Err().
+//
+// There's no interrupting a read that's stuck in the kernel, so the open and
+// read happen in their own goroutine, which is left to finish in the
+// background if the context is done first. That goroutine closes the file
+// itself once the read comes back, so giving up doesn't leak the fd, but it
+// does mean a read that never comes back keeps its goroutine (and fd) for
+// good.
+func (c Config) ReadPressureContext(ctx context.Context) (Pressure, error) {
+	if err := ctx.Err(); err != nil {
+		return Pressure{}, err
+	}
+
+	type result struct {
+		pressure Pressure
+		err      error
+	}
+	// Buffered, so the goroutine can hand over its result and exit even if
+	// nobody's waiting for it anymore.
+	done := make(chan result, 1)
+	go func() {
+		pressure, err := c.ReadPressure()
+		done <- result{pressure, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return Pressure{}, ctx.Err()
+	case r := <-done:
+		return r.pressure, r.err
+	}
+}
+
+// readPressureAt will read the current backpressure from an already open
+// pressure file, such as a trigger's Source. This is a pread from offset 0,
+// so there's no need to seek back to the start, even after a read on the
+// same fd, and whatever the file offset is doesn't matter.
+//
+// Triggers are opened O_NONBLOCK, but that doesn't do anything to reads;
+// the kernel formats the file on demand, and never comes back with EAGAIN.
+// Since a wakeup is when we're most likely to read, and a Source might not be
+// a real pressure file, EAGAIN gets a few more tries (with a short pause)
+// rather than failing the read after an event.
+func readPressureAt(fd io.ReaderAt) (Pressure, error) {
+	var (
+		buf = make([]byte, 256)
+		n   int
+		err error
+	)
+	for {
+		for tries := 0; ; tries++ {
+			n, err = readOnce(fd, buf)
+			if !errors.Is(err, syscall.EAGAIN) || tries >= readRetries {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if err != nil && err != io.EOF {
+			return Pressure{}, err
+		}
+		// A full buffer means there may be more to the file than we've
+		// got, in which case, grow it and read the whole thing again,
+		// since the lines have to come from the same read. Anything
+		// short of full is all there is.
+		if n < len(buf) || len(buf) >= maxPressureFileSize {
+			break
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+	return parsePressure(buf[:n])
+}
+
+// readRetries is how many more times readPressureAt will try a read that
+// came back with EAGAIN before giving up.
+const readRetries = 3
+
+// maxPressureFileSize is the most of a pressure file readPressureAt will
+// read. Pressure files are a couple hundred bytes, so this is only here to
+// keep something that isn't one from eating all the memory.
+const maxPressureFileSize = 64 * 1024
+
+// parsePressure will parse the contents of a pressure file, all of which
+// have already been read into the buffer, since both the "some" and "full"
+// lines need to come from the same read to be consistent with each other.
+func parsePressure(buf []byte) (Pressure, error) {
+	var (
+		pressure Pressure
+		seenSome bool
+	)
+
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		stallType, metrics, err := ParsePressureLine(string(line))
+		if err != nil {
+			return Pressure{}, err
+		}
+		switch stallType {
+		case StallTypeSome:
+			pressure.Some = metrics
+			seenSome = true
+		case StallTypeFull:
+			pressure.Full = &metrics
+		}
+	}
+
+	if !seenSome {
+		return Pressure{}, fmt.Errorf("psi: no \"some\" line in pressure file")
+	}
+	return pressure, nil
+}
+
+// ParsePressureLine will parse a single line of a pressure file, such as
+// "some avg10=0.00 avg60=0.00 avg300=0.00 total=0", returning which
+// StallType the line is for, along with the parsed numbers. Other numeric
+// fields, in case a future kernel adds some, end up in Extra, and anything
+// else that isn't a number is ignored.
+//
+// Averages or totals of "nan" or "-", which is how some kernels fill in the
+// lines when PSI is disabled, aren't an error; they're parsed as 0, and the
+// PressureMetrics are Unavailable.
+//
+// This is the same format used by the cgroup v2 "<resource>.pressure" files,
+// so this can be used to parse those as well.
+func ParsePressureLine(line string) (StallType, PressureMetrics, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", PressureMetrics{}, fmt.Errorf("psi: empty pressure line")
+	}
+
+	stallType := StallType(fields[0])
+	switch stallType {
+	case StallTypeSome, StallTypeFull:
+	default:
+		return "", PressureMetrics{}, fmt.Errorf("psi: unknown stall type %q in pressure line", fields[0])
+	}
+
+	values := map[string]string{}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return "", PressureMetrics{}, fmt.Errorf("psi: malformed field %q in pressure line", field)
+		}
+		// Whatever's reading the file has gone badly wrong if a field
+		// shows up twice, so don't guess which one is right.
+		if _, ok := values[kv[0]]; ok {
+			return "", PressureMetrics{}, fmt.Errorf("psi: duplicate %s field in pressure line", kv[0])
+		}
+		values[kv[0]] = kv[1]
+	}
+
+	var metrics PressureMetrics
+
+	// Fields we don't know about are kept in Extra, so that kernels which
+	// add more of them don't break us, and their numbers aren't lost.
+	for key, value := range values {
+		switch key {
+		case "avg10", "avg60", "avg300", "total":
+			continue
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || !isNumber(f) {
+			continue
+		}
+		if metrics.Extra == nil {
+			metrics.Extra = map[string]float64{}
+		}
+		metrics.Extra[key] = f
+	}
+
+	available := true
+	for _, avg := range []struct {
+		name  string
+		value *float64
+	}{
+		{"avg10", &metrics.Avg10},
+		{"avg60", &metrics.Avg60},
+		{"avg300", &metrics.Avg300},
+	} {
+		value, ok := values[avg.name]
+		if !ok {
+			return "", PressureMetrics{}, fmt.Errorf("psi: missing %s field in pressure line", avg.name)
+		}
+		if value == "-" {
+			available = false
+			continue
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", PressureMetrics{}, fmt.Errorf("psi: bad %s value %q in pressure line", avg.name, value)
+		}
+		if !isNumber(f) {
+			available = false
+			continue
+		}
+		*avg.value = f
+	}
+
+	value, ok := values["total"]
+	if !ok {
+		return "", PressureMetrics{}, fmt.Errorf("psi: missing total field in pressure line")
+	}
+	switch strings.ToLower(value) {
+	case "-", "nan":
+		available = false
+	default:
+		total, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return "", PressureMetrics{}, fmt.Errorf("psi: bad total value %q in pressure line", value)
+		}
+		metrics.Total = total
+	}
+
+	if !available {
+		// Some of the numbers being there and some not is as good as
+		// none of them being there; don't hand out half a line.
+		metrics.Avg10, metrics.Avg60, metrics.Avg300, metrics.Total = 0, 0, 0, 0
+	}
+	metrics.Unavailable = !available
+	return stallType, metrics, nil
+}
+
+// isNumber will return false for NaN and the infinities, which ParseFloat
+// is happy to return, but aren't anything the kernel means to report.
+func isNumber(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,305 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func FuzzParsePressureLine(f *testing.F) {
+	for _, line := range []string{
+		"some avg10=0.12 avg60=0.05 avg300=0.01 total=1234",
+		"some avg10=1.00 avg60=2.00 avg300=3.00 total=456",
+		"full avg10=0.50 avg60=1.00 avg300=1.50 total=78",
+		"some avg10=9.99 avg60=4.00 avg300=0.50 total=99999",
+		"full avg10=3.33 avg60=1.00 avg300=0.10 total=11111",
+		"some avg10=nan avg60=nan avg300=nan total=nan",
+		"some avg10=- avg60=- avg300=- total=-",
+		"some avg10=1.00 avg60=0.00 avg300=0.00 total=10 read=0.75",
+		"some avg10=0,12 avg60=0.00 avg300=0.00 total=0",
+		"some avg10=0.00 avg6",
+	} {
+		f.Add(line)
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		stallType, metrics, err := ParsePressureLine(line)
+		if err != nil {
+			return
+		}
+		if stallType != StallTypeSome && stallType != StallTypeFull {
+			t.Fatalf("ParsePressureLine(%q) StallType = %q", line, stallType)
+		}
+		for _, avg := range []float64{metrics.Avg10, metrics.Avg60, metrics.Avg300} {
+			if math.IsNaN(avg) || math.IsInf(avg, 0) {
+				t.Fatalf("ParsePressureLine(%q) = %+v", line, metrics)
+			}
+		}
+	})
+}
+
+// pressureFixtures will point pressureRoot at a new directory with a file
+// for each of the provided Resources, with the provided contents, until the
+// test is over. Pressure files are only ever opened on Linux, so the test is
+// skipped anywhere else.
+func pressureFixtures(t *testing.T, files map[Resource]string) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("pressure files are only read on Linux")
+	}
+	root := t.TempDir()
+	for resource, contents := range files {
+		if err := os.WriteFile(filepath.Join(root, string(resource)), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := pressureRoot
+	pressureRoot = root
+	t.Cleanup(func() { pressureRoot = old })
+}
+
+func TestParsePressureLine(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		line      string
+		stallType StallType
+		metrics   PressureMetrics
+		wantErr   bool
+	}{
+		{
+			name:      "some",
+			line:      "some avg10=0.12 avg60=0.05 avg300=0.01 total=12345",
+			stallType: StallTypeSome,
+			metrics:   PressureMetrics{Avg10: 0.12, Avg60: 0.05, Avg300: 0.01, Total: 12345},
+		},
+		{
+			name:      "full",
+			line:      "full avg10=1.50 avg60=0.75 avg300=0.25 total=678",
+			stallType: StallTypeFull,
+			metrics:   PressureMetrics{Avg10: 1.5, Avg60: 0.75, Avg300: 0.25, Total: 678},
+		},
+		{
+			name:      "extra whitespace",
+			line:      "  some\tavg10=0.00   avg60=0.00 avg300=0.00  total=0 \n",
+			stallType: StallTypeSome,
+			metrics:   PressureMetrics{},
+		},
+		{name: "empty", line: "", wantErr: true},
+		{name: "blank", line: "   \t", wantErr: true},
+		{name: "unknown type", line: "most avg10=0.00 avg60=0.00 avg300=0.00 total=0", wantErr: true},
+		{name: "missing avg10", line: "some avg60=0.00 avg300=0.00 total=0", wantErr: true},
+		{name: "missing total", line: "some avg10=0.00 avg60=0.00 avg300=0.00", wantErr: true},
+		{name: "no value", line: "some avg10= avg60=0.00 avg300=0.00 total=0", wantErr: true},
+		{name: "no key", line: "some =1 avg10=0.00 avg60=0.00 avg300=0.00 total=0", wantErr: true},
+		{name: "no equals", line: "some avg10 avg60=0.00 avg300=0.00 total=0", wantErr: true},
+		{name: "bad float", line: "some avg10=zero avg60=0.00 avg300=0.00 total=0", wantErr: true},
+		{name: "comma float", line: "some avg10=0,12 avg60=0.00 avg300=0.00 total=0", wantErr: true},
+		{name: "negative total", line: "some avg10=0.00 avg60=0.00 avg300=0.00 total=-1", wantErr: true},
+		{name: "duplicate", line: "some avg10=0.00 avg10=0.00 avg60=0.00 avg300=0.00 total=0", wantErr: true},
+		{name: "truncated", line: "some avg10=0.00 avg6", wantErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stallType, metrics, err := ParsePressureLine(test.line)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("ParsePressureLine(%q) didn't fail", test.line)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePressureLine(%q) = %v", test.line, err)
+			}
+			if stallType != test.stallType {
+				t.Errorf("StallType = %q, want %q", stallType, test.stallType)
+			}
+			if !reflect.DeepEqual(metrics, test.metrics) {
+				t.Errorf("PressureMetrics = %+v, want %+v", metrics, test.metrics)
+			}
+		})
+	}
+}
+
+func TestReadPressureFixtures(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		resource Resource
+		contents string
+		want     Pressure
+	}{
+		{
+			name:     "cpu",
+			resource: ResourceCPU,
+			contents: "some avg10=0.12 avg60=0.05 avg300=0.01 total=1234\n",
+			want: Pressure{
+				Some: PressureMetrics{Avg10: 0.12, Avg60: 0.05, Avg300: 0.01, Total: 1234},
+			},
+		},
+		{
+			name:     "io",
+			resource: ResourceIO,
+			contents: "some avg10=1.00 avg60=2.00 avg300=3.00 total=456\n" +
+				"full avg10=0.50 avg60=1.00 avg300=1.50 total=78\n",
+			want: Pressure{
+				Some: PressureMetrics{Avg10: 1, Avg60: 2, Avg300: 3, Total: 456},
+				Full: &PressureMetrics{Avg10: 0.5, Avg60: 1, Avg300: 1.5, Total: 78},
+			},
+		},
+		{
+			name:     "memory",
+			resource: ResourceMemory,
+			contents: "some avg10=9.99 avg60=4.00 avg300=0.50 total=99999\n" +
+				"full avg10=3.33 avg60=1.00 avg300=0.10 total=11111\n",
+			want: Pressure{
+				Some: PressureMetrics{Avg10: 9.99, Avg60: 4, Avg300: 0.5, Total: 99999},
+				Full: &PressureMetrics{Avg10: 3.33, Avg60: 1, Avg300: 0.1, Total: 11111},
+			},
+		},
+		{
+			name:     "trailing field",
+			resource: ResourceMemory,
+			contents: "some avg10=1.00 avg60=0.00 avg300=0.00 total=10 state=ok\n" +
+				"full avg10=0.50 avg60=0.00 avg300=0.00 total=5 state=ok\n",
+			want: Pressure{
+				Some: PressureMetrics{Avg10: 1, Total: 10},
+				Full: &PressureMetrics{Avg10: 0.5, Total: 5},
+			},
+		},
+		{
+			name:     "unknown token",
+			resource: ResourceIO,
+			contents: "some avg10=1.00 avg60=0.00 avg300=0.00 total=10 read=0.75 write=0.25\n" +
+				"full avg10=0.50 avg60=0.00 avg300=0.00 total=5\n",
+			want: Pressure{
+				Some: PressureMetrics{Avg10: 1, Total: 10, Extra: map[string]float64{"read": 0.75, "write": 0.25}},
+				Full: &PressureMetrics{Avg10: 0.5, Total: 5},
+			},
+		},
+		{
+			name:     "nan",
+			resource: ResourceMemory,
+			contents: "some avg10=nan avg60=nan avg300=nan total=nan\n" +
+				"full avg10=nan avg60=nan avg300=nan total=nan\n",
+			want: Pressure{
+				Some: PressureMetrics{Unavailable: true},
+				Full: &PressureMetrics{Unavailable: true},
+			},
+		},
+		{
+			name:     "dashes",
+			resource: ResourceIO,
+			contents: "some avg10=- avg60=- avg300=- total=-\n" +
+				"full avg10=0.50 avg60=0.00 avg300=0.00 total=5\n",
+			want: Pressure{
+				Some: PressureMetrics{Unavailable: true},
+				Full: &PressureMetrics{Avg10: 0.5, Total: 5},
+			},
+		},
+		{
+			name:     "partly nan",
+			resource: ResourceCPU,
+			contents: "some avg10=1.00 avg60=NaN avg300=0.00 total=10\n",
+			// Half a line is no better than none of it.
+			want: Pressure{
+				Some: PressureMetrics{Unavailable: true},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			pressureFixtures(t, map[Resource]string{test.resource: test.contents})
+			pressure, err := ReadPressure(test.resource)
+			if err != nil {
+				t.Fatalf("ReadPressure() = %v", err)
+			}
+			if !reflect.DeepEqual(pressure, test.want) {
+				t.Fatalf("ReadPressure() = %+v, want %+v", pressure, test.want)
+			}
+		})
+	}
+}
+
+// flakyReaderAt is a pressure file that comes back with EAGAIN for the first
+// few reads, or forever if eagain is less than 0.
+type flakyReaderAt struct {
+	data   string
+	eagain int
+	reads  int
+}
+
+func (r *flakyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.reads++
+	if r.eagain < 0 || r.reads <= r.eagain {
+		return 0, syscall.EAGAIN
+	}
+	if off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestReadPressureAtEAGAIN(t *testing.T) {
+	r := &flakyReaderAt{data: "some avg10=1.00 avg60=0.00 avg300=0.00 total=5\n", eagain: 2}
+	pressure, err := readPressureAt(r)
+	if err != nil {
+		t.Fatalf("readPressureAt() = %v", err)
+	}
+	if pressure.Some.Avg10 != 1 || r.reads != 3 {
+		t.Fatalf("readPressureAt() = %+v after %d reads", pressure, r.reads)
+	}
+
+	r = &flakyReaderAt{data: r.data, eagain: -1}
+	if _, err := readPressureAt(r); !errors.Is(err, syscall.EAGAIN) {
+		t.Fatalf("readPressureAt() = %v, want EAGAIN", err)
+	}
+	if r.reads != readRetries+1 {
+		t.Fatalf("read %d times, want %d", r.reads, readRetries+1)
+	}
+}
+
+func TestReadPressureAtLong(t *testing.T) {
+	// This is more than the first read's buffer, so the read has to
+	// be done over with a bigger one, not stitched together.
+	line := "some avg10=1.00 avg60=0.00 avg300=0.00 total=5"
+	for i := 0; i < 40; i++ {
+		line += fmt.Sprintf(" extra%d=%d", i, i)
+	}
+	r := &flakyReaderAt{data: line + "\nfull avg10=2.00 avg60=0.00 avg300=0.00 total=3\n"}
+	pressure, err := readPressureAt(r)
+	if err != nil {
+		t.Fatalf("readPressureAt() = %v", err)
+	}
+	if len(pressure.Some.Extra) != 40 || pressure.Full == nil || pressure.Full.Avg10 != 2 {
+		t.Fatalf("readPressureAt() = %+v", pressure)
+	}
+}
+
+// vim: foldmethod=marker
@@ -21,12 +21,13 @@
 package psi
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"syscall"
+	"path/filepath"
+	"runtime"
 	"time"
-
-	"golang.org/x/sys/unix"
 )
 
 // Resource to monitor PSI backpressure on. This is currently one of
@@ -43,6 +44,9 @@ var (
 
 	// ResourceMemory represents memory when monitoring
 	ResourceMemory Resource = "memory"
+
+	// knownResources are all the Resources we know about.
+	knownResources = []Resource{ResourceCPU, ResourceIO, ResourceMemory}
 )
 
 // StallType represents how we measure "stall" during the time window.
@@ -58,41 +62,311 @@ var (
 	StallTypeSome StallType = "some"
 )
 
+const (
+	// MinWindowDuration is the shortest WindowDuration the kernel allows.
+	MinWindowDuration = time.Millisecond * 500
+
+	// MaxWindowDuration is the longest WindowDuration the kernel allows.
+	MaxWindowDuration = time.Second * 10
+
+	// MinStallWindowDuration is the shortest StallWindowDuration the kernel
+	// allows.
+	MinStallWindowDuration = time.Millisecond * 50
+
+	// MaxStallWindowDuration is the longest StallWindowDuration we allow.
+	MaxStallWindowDuration = time.Second
+)
+
 // Config sets the parameters used to monitor backpressure on a resource.
 type Config struct {
 	Resource            Resource
 	Type                StallType
 	StallWindowDuration time.Duration
 	WindowDuration      time.Duration
+
+	// MinCallbackInterval, if set, limits how often the callback will be
+	// invoked. Events that happen less than MinCallbackInterval after the
+	// last time the callback was invoked are dropped. This is a rate limit
+	// on our end only; it doesn't change the trigger the kernel uses.
+	MinCallbackInterval time.Duration
+
+	// PollTimeout, if set, is how long to wait for an event before giving
+	// up and invoking OnTick (if set), then going back to waiting. This
+	// lets the monitor do housekeeping while the Resource is quiet; it
+	// doesn't change the trigger the kernel uses. This is ignored by
+	// MonitorAll.
+	PollTimeout time.Duration
+
+	// OnTick, if set, is invoked every PollTimeout that goes by without an
+	// event. As with the callback, returning ErrStopMonitoring will stop
+	// the monitor, and any other error will be returned from it.
+	OnTick func() error
+
+	// FireOnStart, if set, will invoke the callback once right after the
+	// trigger is set up, before waiting for the first event, so that the
+	// current pressure is known from the start. Events passed to an
+	// EventCallback this way have Initial set.
+	FireOnStart bool
+
+	// ContinueOnCallbackError, if set, will keep monitoring when the
+	// callback returns an error (other than ErrStopMonitoring), rather
+	// than returning it. The error is logged to the Logger as a warning
+	// instead, and counted in Stats. This includes panics, if
+	// RecoverPanics is set.
+	ContinueOnCallbackError bool
+
+	// OnCallbackDuration, if set, is told how long each call to the
+	// callback took, to find callbacks slow enough to hold up handling the
+	// events after them.
+	OnCallbackDuration func(time.Duration)
+
+	// RecoverPanics, if set, will recover panics in the callback, and
+	// return a *PanicError from the monitor instead, so a misbehaving
+	// callback doesn't take the whole program down with it.
+	RecoverPanics bool
+
+	// ReopenAttempts, if set, is how many times in a row to try to reopen
+	// the pressure file and set up the trigger again if the kernel reports
+	// an error on it, such as when the cgroup it was set up on is removed
+	// and created again. Attempts are spaced out by ReopenBackoff times
+	// the number of attempts so far. Once ReopenAttempts is used up, the
+	// error is returned. This is ignored by MonitorAll.
+	ReopenAttempts int
+
+	// ReopenBackoff is how long to wait before the first attempt to reopen
+	// the trigger; see ReopenAttempts.
+	ReopenBackoff time.Duration
+
+	// Logger, if set, is told when the trigger is set up, fires, and is
+	// torn down (at debug level), and when the trigger is reopened (as a
+	// warning). A *slog.Logger will do nicely.
+	Logger Logger
+
+	// CgroupPath, if set, is the path of a cgroup v2 cgroup (relative to
+	// the cgroup2 mount at /sys/fs/cgroup, such as
+	// "system.slice/foo.service") whose pressure should be monitored
+	// rather than the system-wide pressure. Leave this empty to use
+	// /proc/pressure. The path can't climb out of the cgroup2 mount; any
+	// ".." past the top just stays at the top.
+	CgroupPath string
+
+	// Path, if set, is the absolute path of the pressure file to use,
+	// which wins over the Resource and CgroupPath, for pressure files that
+	// live somewhere this package doesn't know about. The Resource is still
+	// used for logging and errors, but may be left empty. The file has to
+	// be a regular file (as everything under /proc and /sys is), which is
+	// checked when it's opened.
+	Path string
+
+	// CgroupRoot, if set, is where the cgroup2 hierarchy is mounted, for
+	// systems where that isn't /sys/fs/cgroup. This is only used along
+	// with CgroupPath.
+	CgroupRoot string
+
+	// TriggerTerminator is what's written after the trigger spec to end
+	// it. This defaults to a NUL, which works everywhere we know of, and
+	// is what the kernel documentation uses; it's only here as an escape
+	// hatch for kernels that turn out to be picky.
+	TriggerTerminator TriggerTerminator
+
+	// LockThread, if set, keeps the goroutine waiting on the trigger on
+	// its own OS thread (with runtime.LockOSThread) for as long as it's
+	// monitoring, so that it doesn't have to wait its turn to be scheduled
+	// when the trigger fires. That's most likely to matter when the CPU is
+	// under pressure, which is just when it's needed. The cost is a thread
+	// that does nothing else, which the callback runs on too, so keep the
+	// callback short; goroutines it starts aren't locked to anything. The
+	// thread is unlocked when monitoring stops. For MonitorAll, it's
+	// enough for any one of the Configs to set this.
+	LockThread bool
+
+	// stats, if set, is where the monitor counts events, for Handle.Stats
+	// and Group.Stats.
+	stats *monitorStats
+
+	// stallFraction is set by WithStallFraction, and turned into the
+	// StallWindowDuration by NewConfig once every Option has been applied.
+	stallFraction float64
+}
+
+var (
+	// pressureRoot is where the system-wide pressure files live. This is
+	// only ever changed to point at fixtures when testing.
+	pressureRoot = "/proc/pressure"
+
+	// cgroupRoot is where the cgroup2 hierarchy is mounted. This is only
+	// ever changed to point at fixtures when testing.
+	cgroupRoot = "/sys/fs/cgroup"
+)
+
+// path returns the pressure file to use for this Config.
+func (c Config) path() string {
+	if c.Path != "" {
+		return c.Path
+	}
+	if c.CgroupPath == "" {
+		return filepath.Join(pressureRoot, string(c.Resource))
+	}
+	// Rooting the path before cleaning it means any ".." in it can't get
+	// above the cgroup2 mount.
+	cgroup := filepath.Clean("/" + c.CgroupPath)
+	return filepath.Join(c.cgroupRoot(), cgroup, fmt.Sprintf("%s.pressure", c.Resource))
+}
+
+// open will open the pressure file for this Config, with the provided flags.
+func (c Config) open(flag int) (*os.File, error) {
+	fd, err := openFile(c.path(), flag)
+	if err != nil {
+		return nil, c.checkOpen(err)
+	}
+	if c.Path == "" {
+		return fd, nil
+	}
+
+	stat, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	if !stat.Mode().IsRegular() {
+		fd.Close()
+		return nil, fmt.Errorf("psi: %s is not a regular file", c.Path)
+	}
+	return fd, nil
+}
+
+// cgroupRoot returns where the cgroup2 hierarchy is mounted.
+func (c Config) cgroupRoot() string {
+	if c.CgroupRoot != "" {
+		return c.CgroupRoot
+	}
+	return cgroupRoot
+}
+
+// TriggerSpec returns the trigger spec for this Config, such as
+// "some 150000 1000000", which is the StallType, the StallWindowDuration and
+// the WindowDuration, with the durations in microseconds. This is exactly
+// what gets written to the kernel (less the NUL on the end), which makes it
+// the machine readable counterpart to Explain, such as for logging.
+func (c Config) TriggerSpec() string {
+	return fmt.Sprintf(
+		"%s %d %d",
+		c.Type,
+		c.StallWindowDuration.Microseconds(),
+		c.WindowDuration.Microseconds(),
+	)
+}
+
+// TriggerTerminator is the byte written after the trigger spec, to end it.
+type TriggerTerminator int
+
+const (
+	// TerminatorNUL ends the trigger spec with a NUL, which is the default.
+	TerminatorNUL TriggerTerminator = iota
+
+	// TerminatorNewline ends the trigger spec with a newline, as echo
+	// would.
+	TerminatorNewline
+)
+
+// String will return the name of the TriggerTerminator, "nul" or "newline".
+func (t TriggerTerminator) String() string {
+	switch t {
+	case TerminatorNUL:
+		return "nul"
+	case TerminatorNewline:
+		return "newline"
+	}
+	return fmt.Sprintf("TriggerTerminator(%d)", int(t))
+}
+
+// triggerBytes returns exactly what's written to the pressure file to set up
+// the trigger for this Config, which is the trigger spec, followed by the
+// TriggerTerminator.
+//
+// The terminator matters: since triggers were added (Linux 5.2), writes to
+// /proc/pressure have had their last byte replaced with a NUL before being
+// parsed, so without one, the last digit of the window would be lost. Either
+// a NUL or a newline does the job there. Cgroup pressure files (also 5.2)
+// are NUL terminated by kernfs, and the spec is parsed with sscanf, so either
+// terminator is harmless there too.
+func (c Config) triggerBytes() []byte {
+	terminator := byte(0)
+	if c.TriggerTerminator == TerminatorNewline {
+		terminator = '\n'
+	}
+	return append([]byte(c.TriggerSpec()), terminator)
 }
 
 // Check that the values contained in the Config are valid for use to monitor
 // Backpressure.
 //
-// In particular, this will check the range on provided WindowDuration and
-// StallWindowDuration minimum and maximums.
+// In particular, this will check that the Resource and Type are ones we know
+// about, the range on provided WindowDuration and StallWindowDuration
+// minimum and maximums, and that the StallWindowDuration fits in the
+// WindowDuration.
 //
 // If you're programatically generating the struct, be sure to run `Check` on
 // the values before using them to catch errors in a way that's a bit easier to
-// reason about.
+// reason about. Out of range durations are returned as a *ConfigError, which
+// has the valid range for the field.
+//
+// Check doesn't touch the filesystem, so it can't know what the running
+// kernel supports. Notably, kernels before 5.13 don't report "full" pressure
+// for ResourceCPU, and can't set up a StallTypeFull trigger on it. Rather
+// than a confusing EINVAL, Monitor will return ErrFullCPUUnsupported when
+// setting up the trigger on those kernels, and SupportsFullCPU can be used
+// to check up front.
 func (c Config) Check() error {
-	if c.WindowDuration < time.Millisecond*500 {
-		return fmt.Errorf("Minmum WindowDuration is 500ms")
+	switch {
+	case c.Resource == ResourceCPU, c.Resource == ResourceIO, c.Resource == ResourceMemory:
+	case c.Resource == "" && c.Path != "":
+	default:
+		return fmt.Errorf("psi: unknown Resource %q", c.Resource)
+	}
+
+	if c.Path != "" && !filepath.IsAbs(c.Path) {
+		return fmt.Errorf("psi: Path %q is not absolute", c.Path)
 	}
-	if c.WindowDuration > time.Second*10 {
-		return fmt.Errorf("Maximum WindowDuration is 10s")
+
+	switch c.Type {
+	case StallTypeSome, StallTypeFull:
+	default:
+		return fmt.Errorf("psi: unknown StallType %q", c.Type)
+	}
+
+	if c.WindowDuration < MinWindowDuration || c.WindowDuration > MaxWindowDuration {
+		return &ConfigError{
+			Field: "WindowDuration",
+			Value: c.WindowDuration,
+			Min:   MinWindowDuration,
+			Max:   MaxWindowDuration,
+		}
 	}
 
-	if c.StallWindowDuration < time.Millisecond*50 {
-		return fmt.Errorf("Minmum StallWindowDuration is 50ms")
+	// The StallWindowDuration can't be longer than the WindowDuration, so
+	// that's the maximum if it's shorter than MaxStallWindowDuration.
+	maxStall := MaxStallWindowDuration
+	if c.WindowDuration < maxStall {
+		maxStall = c.WindowDuration
 	}
-	if c.StallWindowDuration > time.Second {
-		return fmt.Errorf("Maximum StallWindowDuration is 1s")
+	if c.StallWindowDuration < MinStallWindowDuration || c.StallWindowDuration > maxStall {
+		return &ConfigError{
+			Field: "StallWindowDuration",
+			Value: c.StallWindowDuration,
+			Min:   MinStallWindowDuration,
+			Max:   maxStall,
+		}
 	}
 
 	return nil
 }
 
+// Validate is the same as Check, for those who'd rather spell it that way.
+func (c Config) Validate() error {
+	return c.Check()
+}
+
 // Explain will return a human readable string explaining what the query will
 // be triggering on.
 func (c Config) Explain() string {
@@ -113,6 +387,58 @@ func (c Config) Explain() string {
 	)
 }
 
+// Preview will Check the Config, and return the Explain string, along with
+// exactly what would be written to which pressure file to set up the
+// trigger. This doesn't open any files, so it works on systems without PSI,
+// which makes it handy for config tooling.
+func (c Config) Preview() (string, error) {
+	if err := c.Check(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(
+		"%swould write %q to %s\n",
+		c.Explain(),
+		c.triggerBytes(),
+		c.path(),
+	), nil
+}
+
+// sameFile will return true if both Configs are for the same pressure file.
+func (c Config) sameFile(other Config) bool {
+	return c.Resource == other.Resource &&
+		c.CgroupPath == other.CgroupPath &&
+		c.CgroupRoot == other.CgroupRoot &&
+		c.Path == other.Path
+}
+
+// Equal will return true if both Configs would set up the same trigger on
+// the same file, and monitor it the same way, which is handy for working out
+// whether a reloaded Config means a monitor needs to be re-armed.
+//
+// Funcs can't be compared, so OnTick and OnCallbackDuration are ignored, as
+// is the Logger, since swapping out where logs go doesn't change anything
+// about what's being monitored. Durations are compared as they are, so a
+// WindowDuration of 2s and 2000ms are Equal, but Configs that differ only by
+// a default (such as an empty CgroupRoot and "/sys/fs/cgroup") are not.
+func (c Config) Equal(other Config) bool {
+	return c.Resource == other.Resource &&
+		c.Type == other.Type &&
+		c.StallWindowDuration == other.StallWindowDuration &&
+		c.WindowDuration == other.WindowDuration &&
+		c.MinCallbackInterval == other.MinCallbackInterval &&
+		c.PollTimeout == other.PollTimeout &&
+		c.FireOnStart == other.FireOnStart &&
+		c.ContinueOnCallbackError == other.ContinueOnCallbackError &&
+		c.RecoverPanics == other.RecoverPanics &&
+		c.ReopenAttempts == other.ReopenAttempts &&
+		c.ReopenBackoff == other.ReopenBackoff &&
+		c.CgroupPath == other.CgroupPath &&
+		c.Path == other.Path &&
+		c.CgroupRoot == other.CgroupRoot &&
+		c.TriggerTerminator == other.TriggerTerminator &&
+		c.LockThread == other.LockThread
+}
+
 // MonitorCallback allows Monitor to invoke a callback when the backpressure
 // exceeds the provided thresholds.
 type MonitorCallback func() error
@@ -121,52 +447,284 @@ var (
 	// ErrStopMonitoring allows `MonitorCallback`s to tell Monitor to bail
 	// and stop paying attention.
 	ErrStopMonitoring error = fmt.Errorf("psi: stop it")
+
+	// ErrUnsupported is returned when trying to monitor or read
+	// backpressure on a platform other than Linux, which is the only one
+	// with PSI.
+	ErrUnsupported error = fmt.Errorf("psi: unsupported platform")
+
+	// ErrPSIUnsupported is returned (wrapped, so use errors.Is) when the
+	// running kernel has no pressure file for a Resource, either because
+	// it was built without CONFIG_PSI or because PSI was disabled at boot.
+	ErrPSIUnsupported error = fmt.Errorf("psi: kernel does not support PSI")
+
+	// ErrTriggerUnsupported is returned (wrapped, so use errors.Is) when
+	// the kernel has PSI, but refuses to set up a trigger on the pressure
+	// file, or is older than 5.2, and can't.
+	ErrTriggerUnsupported error = fmt.Errorf("psi: kernel does not support PSI triggers")
+
+	// ErrTriggerFailed is returned when the kernel reports an error on a
+	// trigger while waiting for events, such as if the trigger is gone.
+	ErrTriggerFailed error = fmt.Errorf("psi: kernel reported an error on the trigger")
+
+	// ErrTriggerClosed is returned when the kernel hangs up on a trigger
+	// while waiting for events, such as when the cgroup it was set up on
+	// is removed.
+	ErrTriggerClosed error = fmt.Errorf("psi: kernel closed the trigger")
+
+	// ErrFullCPUUnsupported is returned when trying to monitor StallTypeFull
+	// on ResourceCPU on a kernel that doesn't report it.
+	ErrFullCPUUnsupported error = fmt.Errorf("psi: kernel does not report full pressure for cpu")
+
+	// ErrCallbackPanic is matched (using errors.Is) by the *PanicError
+	// returned when a callback panics and Config.RecoverPanics is set.
+	ErrCallbackPanic error = fmt.Errorf("psi: callback panicked")
+
+	// ErrDropped can be returned by a callback to say it's decided not to
+	// act on an event, as callbacks wrapped with Throttle do. Monitors
+	// count it in Stats.Dropped (and Event.Dropped), rather than treating
+	// it as an error.
+	ErrDropped error = fmt.Errorf("psi: event dropped")
+
+	// ErrNoConfigs is returned by MonitorAll (and friends) when there's
+	// nothing to monitor, rather than waiting forever on nothing.
+	ErrNoConfigs error = fmt.Errorf("psi: no Configs to monitor")
 )
 
 // Monitor will invoke the provided Callback every time the backpressure
 // thresholds exceed the provided configuration.
 func Monitor(config Config, cb MonitorCallback) error {
+	return MonitorContext(context.Background(), config, cb)
+}
+
+// MonitorCPU is Monitor, for ResourceCPU.
+func MonitorCPU(stallType StallType, stall, window time.Duration, cb MonitorCallback) error {
+	return monitorResource(ResourceCPU, stallType, stall, window, cb)
+}
+
+// MonitorIO is Monitor, for ResourceIO.
+func MonitorIO(stallType StallType, stall, window time.Duration, cb MonitorCallback) error {
+	return monitorResource(ResourceIO, stallType, stall, window, cb)
+}
+
+// MonitorMemory is Monitor, for ResourceMemory.
+func MonitorMemory(stallType StallType, stall, window time.Duration, cb MonitorCallback) error {
+	return monitorResource(ResourceMemory, stallType, stall, window, cb)
+}
+
+func monitorResource(
+	resource Resource,
+	stallType StallType,
+	stall, window time.Duration,
+	cb MonitorCallback,
+) error {
+	return Monitor(Config{
+		Resource:            resource,
+		Type:                stallType,
+		StallWindowDuration: stall,
+		WindowDuration:      window,
+	}, cb)
+}
+
+// MonitorContext will invoke the provided Callback every time the
+// backpressure thresholds exceed the provided configuration, until either
+// the callback returns an error or the provided context is cancelled.
+//
+// If the callback returns ErrStopMonitoring, MonitorContext will return nil.
+// If the context is cancelled, MonitorContext will return ctx.Err() as soon
+// as the cancellation is noticed, even if the kernel never delivers an event.
+func MonitorContext(ctx context.Context, config Config, cb MonitorCallback) error {
 	if err := config.Check(); err != nil {
 		return err
 	}
 
-	fd, err := os.OpenFile(
-		fmt.Sprintf("/proc/pressure/%s", config.Resource),
-		syscall.O_RDWR|syscall.O_NONBLOCK,
-		0,
-	)
+	trigger, err := openTrigger(config)
 	if err != nil {
 		return err
 	}
-	defer fd.Close()
 
-	_, err = fmt.Fprintf(
-		fd,
-		"%s %d %d\x00",
-		config.Type,
-		config.StallWindowDuration.Microseconds(),
-		config.WindowDuration.Microseconds(),
-	)
-	if err != nil {
-		return err
+	return run(ctx, trigger, func(*Trigger, wakeup) error { return cb() })
+}
+
+// MonitorAll will set up a trigger for each of the provided Configs, and
+// invoke the provided callback with the Config whose thresholds were exceeded
+// every time one of them trips. All the triggers are waited on together, so
+// this only needs the one goroutine.
+//
+// If the callback returns ErrStopMonitoring, all the triggers are torn down,
+// and MonitorAll will return nil. The PollTimeout and OnTick of the Configs
+// are ignored.
+//
+// If any trigger fails, everything is torn down, and the error is returned;
+// use MonitorAllContext with ContinueOnError to keep the others going. If
+// there are no Configs at all, ErrNoConfigs is returned right away.
+func MonitorAll(configs []Config, cb func(Config) error) error {
+	return MonitorAllContext(context.Background(), configs, cb, FailFast)
+}
+
+// ErrorPolicy is what MonitorAllContext does when one of its triggers fails.
+type ErrorPolicy int
+
+const (
+	// FailFast tears all the triggers down as soon as any one of them
+	// fails, and returns the error. This is the default.
+	FailFast ErrorPolicy = iota
+
+	// ContinueOnError closes just the trigger that failed, and keeps
+	// watching the rest. The failure is logged (as a warning) to the
+	// failed Config's Logger right away, and returned, joined with any
+	// others (using errors.Join), once monitoring stops. If every trigger
+	// fails, monitoring stops.
+	//
+	// This only covers the kernel reporting an error on a trigger;
+	// failing to set the triggers up, and errors from the callback, still
+	// stop everything.
+	ContinueOnError
+)
+
+// MonitorAllContext is MonitorAll, but stops once the context is cancelled,
+// and lets the caller pick what happens when one of the triggers fails.
+func MonitorAllContext(ctx context.Context, configs []Config, cb func(Config) error, policy ErrorPolicy) error {
+	cbs := make([]func(*Trigger, wakeup) error, len(configs))
+	for i, config := range configs {
+		config := config
+		cbs[i] = func(*Trigger, wakeup) error { return cb(config) }
 	}
+	return monitorAll(ctx, configs, cbs, policy)
+}
 
-	for {
-		_, err := unix.Poll([]unix.PollFd{unix.PollFd{
-			Fd:     int32(fd.Fd()),
-			Events: syscall.EPOLLPRI,
-		}}, -1)
+// Threshold is a Config, along with the callback to invoke when its
+// thresholds are exceeded.
+type Threshold struct {
+	Config   Config
+	Callback MonitorCallback
+}
+
+// MonitorThresholds will set up a trigger for each of the provided
+// Thresholds, and invoke the Callback of whichever one was exceeded every time
+// one of them trips. This is handy to respond differently to different levels
+// of backpressure on the same Resource, such as logging at a warning
+// threshold, and shedding load at a critical one.
+//
+// The kernel only allows one trigger per open pressure file, so each
+// Threshold gets its own, but they're all waited on together, so this only
+// needs the one goroutine. All the Thresholds need to be for the same
+// pressure file (the same Resource, CgroupPath, CgroupRoot and Path); use
+// MonitorAll to watch different ones.
+//
+// If a Callback returns ErrStopMonitoring, all the triggers are torn down,
+// and MonitorThresholds will return nil. The PollTimeout and OnTick of the
+// Configs are ignored.
+func MonitorThresholds(thresholds []Threshold) error {
+	configs := make([]Config, len(thresholds))
+	cbs := make([]func(*Trigger, wakeup) error, len(thresholds))
+	for i, threshold := range thresholds {
+		if !threshold.Config.sameFile(thresholds[0].Config) {
+			return fmt.Errorf("psi: all Thresholds must be for the same Resource")
+		}
+		configs[i] = threshold.Config
+		callback := threshold.Callback
+		cbs[i] = func(*Trigger, wakeup) error { return callback() }
+	}
+	return monitorAll(context.Background(), configs, cbs, FailFast)
+}
+
+// monitorAll will set up a trigger for each of the provided Configs, and
+// invoke the callback at the same index when it trips.
+func monitorAll(ctx context.Context, configs []Config, cbs []func(*Trigger, wakeup) error, policy ErrorPolicy) error {
+	if len(configs) == 0 {
+		return ErrNoConfigs
+	}
+	for _, config := range configs {
+		if err := config.Check(); err != nil {
+			return err
+		}
+	}
+
+	triggers := make([]*Trigger, 0, len(configs))
+	defer func() {
+		for i, trigger := range triggers {
+			trigger.Close()
+			configs[i].logger().Debug("psi: trigger closed", configs[i].logArgs()...)
+		}
+	}()
+	for _, config := range configs {
+		trigger, err := openTrigger(config)
 		if err != nil {
 			return err
 		}
-		if err := cb(); err != nil {
+		triggers = append(triggers, trigger)
+	}
+
+	for _, config := range configs {
+		if config.LockThread {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			break
+		}
+	}
+
+	wakes := make([]wakeup, len(cbs))
+	limited := make([]func() error, len(cbs))
+	initial := make([]func() error, len(cbs))
+	for i, config := range configs {
+		i := i
+		limited[i], initial[i] = config.wrapCallback(func() error {
+			return wakes[i].deliver(func() error { return cbs[i](triggers[i], wakes[i]) })
+		})
+	}
+
+	for i, config := range configs {
+		if !config.FireOnStart {
+			continue
+		}
+		wakes[i].initial = true
+		err := initial[i]()
+		wakes[i].initial = false
+		if err != nil {
 			if err == ErrStopMonitoring {
-				break
+				return nil
 			}
 			return err
 		}
 	}
-	return nil
+
+	// active maps the triggers still being watched back to their index in
+	// configs, since failed ones are dropped with ContinueOnError.
+	active := make([]int, len(triggers))
+	for i := range active {
+		active[i] = i
+	}
+
+	var errs []error
+	for {
+		watching := make([]*Trigger, len(active))
+		for i, j := range active {
+			watching[i] = triggers[j]
+		}
+		err := watchMany(ctx, watching, func(i int) error {
+			wakes[active[i]].seq++
+			return limited[active[i]]()
+		})
+
+		var failed *triggerFailure
+		if policy != ContinueOnError || !errors.As(err, &failed) {
+			if len(errs) == 0 {
+				return err
+			}
+			// errors.Join skips err if it's nil.
+			return errors.Join(append([]error{err}, errs...)...)
+		}
+
+		j := active[failed.index]
+		configs[j].logger().Warn("psi: trigger failed", configs[j].logArgs("err", failed.err)...)
+		triggers[j].Close()
+		errs = append(errs, fmt.Errorf("psi: %s: %w", configs[j].Resource, failed.err))
+		active = append(active[:failed.index], active[failed.index+1:]...)
+		if len(active) == 0 {
+			return errors.Join(errs...)
+		}
+	}
 }
 
 // vim: foldmethod=marker
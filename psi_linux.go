@@ -0,0 +1,377 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+//go:build linux
+// +build linux
+
+package psi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// poll is unix.Poll, unless it's been swapped out to test the watch loop.
+var poll = unix.Poll
+
+// openFile will open one of the files under /proc or /sys we read pressure
+// from. This is just os.OpenFile on Linux, since that's where the files are.
+//
+// The os package already opens everything O_CLOEXEC, but since a trigger fd
+// leaking into a child would keep the trigger around for as long as the
+// child lives, it's spelled out here rather than left to chance.
+func openFile(path string, flag int) (*os.File, error) {
+	return os.OpenFile(path, flag|syscall.O_CLOEXEC, 0)
+}
+
+// openTrigger will open the pressure file for the configured Resource, and
+// register the configured trigger with the kernel. The trigger stays around
+// until the returned Trigger is closed.
+func openTrigger(config Config) (*Trigger, error) {
+	fd, err := config.open(syscall.O_RDWR | syscall.O_NONBLOCK)
+	if err != nil {
+		if errors.Is(err, ErrPSIUnsupported) {
+			return nil, err
+		}
+		return nil, checkTriggerError(err)
+	}
+
+	// Kernels that don't report "full" pressure for the CPU will fail to
+	// set up a trigger with a confusing EINVAL, so check for ourselves.
+	if config.Resource == ResourceCPU && config.Type == StallTypeFull {
+		if pressure, err := readPressureAt(fd); err == nil && pressure.Full == nil {
+			fd.Close()
+			return nil, ErrFullCPUUnsupported
+		}
+	}
+
+	trigger := config.TriggerSpec()
+	if _, err := fd.Write(config.triggerBytes()); err != nil {
+		fd.Close()
+		return nil, checkTriggerError(&TriggerError{Config: config, Trigger: trigger, Err: err})
+	}
+	config.logger().Debug("psi: trigger set up", config.logArgs("trigger", trigger)...)
+	return &Trigger{config: config, source: fd}, nil
+}
+
+// readOnce will read from the start of a pressure file with exactly one
+// pread. os.File's ReadAt keeps going until the buffer is full, and each
+// pread past the first one has the kernel format the whole file over again,
+// so if the numbers grew a digit in between, we'd stitch the end of one read
+// onto the start of another. Anything that isn't an *os.File (like a fake
+// Source) just gets ReadAt.
+func readOnce(r io.ReaderAt, buf []byte) (int, error) {
+	fd, ok := r.(*os.File)
+	if !ok {
+		return r.ReadAt(buf, 0)
+	}
+	conn, err := fd.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		n       int
+		readErr error
+	)
+	if err := conn.Read(func(fd uintptr) bool {
+		n, readErr = unix.Pread(int(fd), buf, 0)
+		return true
+	}); err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		n = 0
+	}
+	if readErr != nil {
+		return n, readErr
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// kernelRelease will return the running kernel's release, such as
+// "5.15.0-91-generic".
+func kernelRelease() (string, error) {
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		return "", err
+	}
+	return unix.ByteSliceToString(uname.Release[:]), nil
+}
+
+// isCgroup2 will return true if the provided path is the root of a cgroup2
+// filesystem.
+func isCgroup2(path string) (bool, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		if errors.Is(err, unix.ENOENT) {
+			return false, nil
+		}
+		return false, err
+	}
+	return stat.Type == unix.CGROUP2_SUPER_MAGIC, nil
+}
+
+// explainTriggerError will return a friendlier explanation of why the kernel
+// may have refused to set up a trigger, if we have any idea.
+func explainTriggerError(err error) string {
+	var errno unix.Errno
+	if !errors.As(err, &errno) {
+		return ""
+	}
+	switch errno {
+	case unix.EINVAL:
+		return "EINVAL (check the windows are in range, that the kernel supports this Resource and Type, and without CAP_SYS_RESOURCE, that the WindowDuration is a multiple of 2s)"
+	case unix.ENOTSUP:
+		return "ENOTSUP (the kernel does not support PSI triggers)"
+	case unix.EACCES, unix.EPERM:
+		return fmt.Sprintf("%s (this kernel needs CAP_SYS_RESOURCE to set up triggers)", unix.ErrnoName(errno))
+	case unix.EBUSY:
+		return "EBUSY (a trigger is already set up on this file)"
+	}
+	return unix.ErrnoName(errno)
+}
+
+// openCancelFd will return an eventfd that becomes readable once the context
+// is done, so that we can wait on it along with the triggers, rather than
+// waking up every so often to check ctx.Done(). The returned func closes it.
+//
+// This is also why there's no need for ppoll and a signal mask: the Go
+// runtime handles signals itself, on whatever thread, and anything that
+// turns a signal into a cancelled context (like MonitorSignals) ends up
+// writing to the eventfd. That stays readable until we close it, so a signal
+// that comes in just before we Poll isn't lost; the Poll returns right away.
+func openCancelFd(ctx context.Context) (int, func(), error) {
+	cancelFd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		return -1, nil, err
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			unix.Write(cancelFd, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+		case <-done:
+		}
+	}()
+	return cancelFd, func() {
+		// Make sure the goroutine is gone before closing the eventfd, so
+		// it can't write into some other fd that reused the number.
+		close(done)
+		<-exited
+		unix.Close(cancelFd)
+	}, nil
+}
+
+// watch will wait for events on triggers opened by openTrigger, invoking the
+// callback with the index of the trigger for each event, until the callback
+// returns an error or the context is cancelled.
+//
+// If timeout is more than 0, tick (if not nil) is invoked every time that
+// long goes by without an event.
+func watch(
+	ctx context.Context,
+	triggers []*Trigger,
+	timeout time.Duration,
+	tick func() error,
+	cb func(int) error,
+) error {
+	cancelFd, closeCancelFd, err := openCancelFd(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeCancelFd()
+
+	pollTimeout := -1
+	if timeout > 0 {
+		pollTimeout = int(timeout / time.Millisecond)
+		if pollTimeout == 0 {
+			pollTimeout = 1
+		}
+	}
+
+	// Sources that don't clear the event by themselves need to be drained,
+	// but real triggers don't, so sort out which is which up front.
+	drainers := make([]drainer, len(triggers))
+	for i, trigger := range triggers {
+		drainers[i], _ = trigger.source.(drainer)
+	}
+
+	fds := make([]unix.PollFd, len(triggers)+1)
+	for {
+		for i, trigger := range triggers {
+			// This is poll, not epoll, so it's POLLPRI, not EPOLLPRI.
+			// They happen to be the same on Linux, but the kernel
+			// documentation is written with epoll in mind, so it's easy
+			// to mix them up.
+			fds[i] = unix.PollFd{
+				Fd:     int32(trigger.Fd()),
+				Events: unix.POLLPRI,
+			}
+		}
+		fds[len(triggers)] = unix.PollFd{
+			Fd:     int32(cancelFd),
+			Events: unix.POLLIN,
+		}
+		n, err := poll(fds, pollTimeout)
+		if err == unix.EINTR {
+			// A signal came in while we were waiting, which is a normal
+			// thing to happen to a process; just go back to waiting.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			if tick == nil {
+				continue
+			}
+			if err := tick(); err != nil {
+				if err == ErrStopMonitoring {
+					return nil
+				}
+				return err
+			}
+			continue
+		}
+		if fds[len(triggers)].Revents != 0 {
+			return ctx.Err()
+		}
+		for i := range triggers {
+			revents := fds[i].Revents
+			switch {
+			case revents&unix.POLLNVAL != 0:
+				return &triggerFailure{i, fmt.Errorf("psi: trigger fd %d is not open: %w", fds[i].Fd, unix.EBADF)}
+			case revents&unix.POLLERR != 0:
+				// The kernel reports POLLERR (along with POLLPRI) when
+				// there's no trigger on the fd, so this has to be checked
+				// before POLLPRI.
+				return &triggerFailure{i, ErrTriggerFailed}
+			case revents&unix.POLLHUP != 0:
+				return &triggerFailure{i, ErrTriggerClosed}
+			case revents&unix.POLLPRI == 0:
+				continue
+			}
+			if drainers[i] != nil {
+				if err := drainers[i].Drain(); err != nil {
+					return err
+				}
+			}
+			if err := cb(i); err != nil {
+				if err == ErrStopMonitoring {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+}
+
+// watchMany is watch, without the timeout, for lots of triggers at once. This
+// uses epoll rather than poll, so that each wakeup only costs as much as the
+// number of triggers that fired, rather than the number being watched.
+//
+// The kernel clears a trigger's event as part of reporting it, whether to
+// poll or epoll, so level triggered epoll works the same as poll does.
+func watchMany(ctx context.Context, triggers []*Trigger, cb func(int) error) error {
+	cancelFd, closeCancelFd, err := openCancelFd(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeCancelFd()
+
+	epfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(epfd)
+
+	// Each fd is registered with its index into triggers, with the cancel
+	// fd at the end.
+	for i, trigger := range triggers {
+		event := unix.EpollEvent{Events: unix.EPOLLPRI, Fd: int32(i)}
+		if err := unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, trigger.Fd(), &event); err != nil {
+			return &triggerFailure{i, err}
+		}
+	}
+	event := unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(len(triggers))}
+	if err := unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, cancelFd, &event); err != nil {
+		return err
+	}
+
+	drainers := make([]drainer, len(triggers))
+	for i, trigger := range triggers {
+		drainers[i], _ = trigger.source.(drainer)
+	}
+
+	events := make([]unix.EpollEvent, len(triggers)+1)
+	for {
+		n, err := unix.EpollWait(epfd, events, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, event := range events[:n] {
+			i := int(event.Fd)
+			if i == len(triggers) {
+				return ctx.Err()
+			}
+		}
+		for _, event := range events[:n] {
+			i := int(event.Fd)
+			switch {
+			case event.Events&unix.EPOLLERR != 0:
+				// As with poll, no trigger on the fd is reported as
+				// EPOLLERR along with EPOLLPRI.
+				return &triggerFailure{i, ErrTriggerFailed}
+			case event.Events&unix.EPOLLHUP != 0:
+				return &triggerFailure{i, ErrTriggerClosed}
+			case event.Events&unix.EPOLLPRI == 0:
+				continue
+			}
+			if drainers[i] != nil {
+				if err := drainers[i].Drain(); err != nil {
+					return err
+				}
+			}
+			if err := cb(i); err != nil {
+				if err == ErrStopMonitoring {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,135 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+//go:build linux
+// +build linux
+
+package psi
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// nopSource is a Source that's never read or written; the tests that use it
+// swap out poll, so the fd doesn't matter.
+type nopSource struct{}
+
+func (nopSource) ReadAt([]byte, int64) (int, error) { return 0, errors.New("psi: nopSource") }
+func (nopSource) Write(b []byte) (int, error)       { return len(b), nil }
+func (nopSource) Close() error                      { return nil }
+func (nopSource) Fd() uintptr                       { return 0 }
+
+// pollResult is what one call to a fakePoll returns: either an error, or
+// revents on the first fd.
+type pollResult struct {
+	revents int16
+	err     error
+}
+
+// fakePoll swaps poll for one that hands back each of results in turn. It's
+// undone when the test finishes.
+func fakePoll(t *testing.T, results ...pollResult) *int {
+	t.Helper()
+	calls := 0
+	poll = func(fds []unix.PollFd, timeout int) (int, error) {
+		if calls >= len(results) {
+			t.Fatalf("poll called %d times, want %d", calls+1, len(results))
+		}
+		result := results[calls]
+		calls++
+		if result.err != nil {
+			return -1, result.err
+		}
+		fds[0].Revents = result.revents
+		return 1, nil
+	}
+	t.Cleanup(func() { poll = unix.Poll })
+	return &calls
+}
+
+func TestWatchEINTR(t *testing.T) {
+	calls := fakePoll(t,
+		pollResult{err: unix.EINTR},
+		pollResult{revents: unix.POLLPRI},
+	)
+
+	trigger := &Trigger{source: nopSource{}, fromSource: true}
+	fired := 0
+	err := watch(context.Background(), []*Trigger{trigger}, 0, nil, func(int) error {
+		fired++
+		return ErrStopMonitoring
+	})
+	if err != nil {
+		t.Fatalf("watch() = %v", err)
+	}
+	if *calls != 2 || fired != 1 {
+		t.Fatalf("poll called %d times and fired %d times, want 2 and 1", *calls, fired)
+	}
+}
+
+func TestWatchErrorRevents(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		revents int16
+		want    error
+	}{
+		{name: "POLLERR", revents: unix.POLLERR | unix.POLLPRI, want: ErrTriggerFailed},
+		{name: "POLLHUP", revents: unix.POLLHUP, want: ErrTriggerClosed},
+		{name: "POLLNVAL", revents: unix.POLLNVAL, want: unix.EBADF},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fakePoll(t, pollResult{revents: test.revents})
+
+			trigger := &Trigger{source: nopSource{}, fromSource: true}
+			err := watch(context.Background(), []*Trigger{trigger}, 0, nil, func(int) error {
+				t.Fatal("callback fired on an error revent")
+				return nil
+			})
+			if !errors.Is(err, test.want) {
+				t.Fatalf("watch() = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestTriggerNotInherited(t *testing.T) {
+	config := idleConfig(t)
+	trigger, err := NewTrigger(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trigger.Close()
+
+	out, err := exec.Command("ls", "-l", "/proc/self/fd").CombinedOutput()
+	if err != nil {
+		t.Fatalf("ls: %v: %s", err, out)
+	}
+	if strings.Contains(string(out), config.Path) {
+		t.Fatalf("trigger fd %d leaked into the child:\n%s", trigger.Fd(), out)
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,76 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+//go:build !linux
+// +build !linux
+
+package psi
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// PSI is a Linux thing, so everywhere else the pieces that talk to the kernel
+// just return ErrUnsupported. The rest of the package builds on top of
+// these, so the public API is the same on every platform, and everything
+// that would touch /proc or /sys returns ErrUnsupported.
+
+func openFile(path string, flag int) (*os.File, error) {
+	return nil, ErrUnsupported
+}
+
+func openTrigger(config Config) (*Trigger, error) {
+	return nil, ErrUnsupported
+}
+
+func watch(
+	ctx context.Context,
+	triggers []*Trigger,
+	timeout time.Duration,
+	tick func() error,
+	cb func(int) error,
+) error {
+	return ErrUnsupported
+}
+
+func readOnce(r io.ReaderAt, buf []byte) (int, error) {
+	return r.ReadAt(buf, 0)
+}
+
+func kernelRelease() (string, error) {
+	return "", ErrUnsupported
+}
+
+func isCgroup2(path string) (bool, error) {
+	return false, ErrUnsupported
+}
+
+func watchMany(ctx context.Context, triggers []*Trigger, cb func(int) error) error {
+	return ErrUnsupported
+}
+
+func explainTriggerError(err error) string {
+	return ""
+}
+
+// vim: foldmethod=marker
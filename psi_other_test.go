@@ -0,0 +1,77 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+//go:build !linux
+// +build !linux
+
+package psi_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"pault.ag/go/psi"
+)
+
+// Everywhere but Linux, the whole API is there (or this wouldn't build), but
+// everything that would touch the kernel returns ErrUnsupported.
+func TestStubsUnsupported(t *testing.T) {
+	config := psi.Config{
+		Resource:            psi.ResourceMemory,
+		Type:                psi.StallTypeSome,
+		StallWindowDuration: 150 * time.Millisecond,
+		WindowDuration:      time.Second,
+	}
+	cb := func() error { return nil }
+	ctx := context.Background()
+
+	for name, call := range map[string]func() error{
+		"Monitor":        func() error { return psi.Monitor(config, cb) },
+		"MonitorContext": func() error { return psi.MonitorContext(ctx, config, cb) },
+		"MonitorAll": func() error {
+			return psi.MonitorAll([]psi.Config{config}, func(psi.Config) error { return nil })
+		},
+		"WaitForStall": func() error { _, err := psi.WaitForStall(ctx, config); return err },
+		"NewTrigger":   func() error { _, err := psi.NewTrigger(config); return err },
+		"ReadPressure": func() error { _, err := psi.ReadPressure(psi.ResourceCPU); return err },
+		"ReadCgroupPressure": func() error {
+			_, err := psi.ReadCgroupPressure("system.slice", psi.ResourceCPU)
+			return err
+		},
+		"NewSampler":             func() error { _, err := psi.NewSampler(); return err },
+		"Probe":                  func() error { return psi.Probe(psi.ResourceCPU) },
+		"KernelSupportsTriggers": func() error { _, err := psi.KernelSupportsTriggers(); return err },
+	} {
+		if err := call(); !errors.Is(err, psi.ErrUnsupported) {
+			t.Errorf("%s() = %v, want ErrUnsupported", name, err)
+		}
+	}
+
+	if psi.Available() {
+		t.Error("Available() = true")
+	}
+	if status := psi.ProbeStatus(); status != psi.StatusUnsupported {
+		t.Errorf("ProbeStatus() = %s, want %s", status, psi.StatusUnsupported)
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,98 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	valid := Config{
+		Resource:            ResourceMemory,
+		Type:                StallTypeSome,
+		StallWindowDuration: 150 * time.Millisecond,
+		WindowDuration:      time.Second,
+	}
+
+	for _, test := range []struct {
+		name   string
+		change func(*Config)
+		field  string
+	}{
+		{name: "valid", change: func(*Config) {}},
+		{name: "path only", change: func(c *Config) { c.Resource, c.Path = "", "/proc/pressure/memory" }},
+		{name: "stall equal to window", change: func(c *Config) {
+			c.StallWindowDuration, c.WindowDuration = time.Second, time.Second
+		}},
+		{name: "stall longer than window", field: "StallWindowDuration", change: func(c *Config) {
+			c.StallWindowDuration, c.WindowDuration = 800*time.Millisecond, 600*time.Millisecond
+		}},
+		{name: "stall too short", field: "StallWindowDuration", change: func(c *Config) {
+			c.StallWindowDuration = time.Millisecond
+		}},
+		{name: "window too short", field: "WindowDuration", change: func(c *Config) {
+			c.WindowDuration = 100 * time.Millisecond
+		}},
+		{name: "window too long", field: "WindowDuration", change: func(c *Config) {
+			c.WindowDuration = time.Minute
+		}},
+		{name: "unknown resource", field: "-", change: func(c *Config) { c.Resource = "disk" }},
+		{name: "unknown type", field: "-", change: func(c *Config) { c.Type = "most" }},
+		{name: "relative path", field: "-", change: func(c *Config) { c.Path = "memory" }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := valid
+			test.change(&config)
+			err := config.Check()
+			switch test.field {
+			case "":
+				if err != nil {
+					t.Fatalf("Check() = %v", err)
+				}
+			case "-":
+				if err == nil {
+					t.Fatal("Check() didn't fail")
+				}
+			default:
+				var configErr *ConfigError
+				if !errors.As(err, &configErr) {
+					t.Fatalf("Check() = %v, want a *ConfigError", err)
+				}
+				if configErr.Field != test.field {
+					t.Fatalf("ConfigError.Field = %q, want %q", configErr.Field, test.field)
+				}
+			}
+		})
+	}
+}
+
+func TestMonitorAllEmpty(t *testing.T) {
+	if err := MonitorAll(nil, func(Config) error { return nil }); !errors.Is(err, ErrNoConfigs) {
+		t.Fatalf("MonitorAll(nil) = %v, want ErrNoConfigs", err)
+	}
+	if err := MonitorThresholds(nil); !errors.Is(err, ErrNoConfigs) {
+		t.Fatalf("MonitorThresholds(nil) = %v, want ErrNoConfigs", err)
+	}
+}
+
+// vim: foldmethod=marker
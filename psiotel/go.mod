@@ -0,0 +1,13 @@
+module pault.ag/go/psi/psiotel
+
+go 1.21
+
+require (
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/metric v1.28.0
+	pault.ag/go/psi v0.0.0-00010101000000-000000000000
+)
+
+require golang.org/x/sys v0.22.0 // indirect
+
+replace pault.ag/go/psi => ../
@@ -0,0 +1,124 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+// Package psiotel exports PSI backpressure using the OpenTelemetry metrics
+// API.
+//
+// Pressure is read from /proc/pressure when the metrics are collected, so
+// there's no background goroutine to manage.
+//
+// This is its own module, so that only programs which use it pull in
+// OpenTelemetry, rather than everything that uses psi.
+package psiotel
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"pault.ag/go/psi"
+)
+
+// Register will create observable instruments for the backpressure on each
+// of the provided Resources (or all of ResourceCPU, ResourceIO and
+// ResourceMemory if none are provided) on the provided Meter.
+//
+// The averages are reported as the psi.avg10, psi.avg60 and psi.avg300
+// gauges, and the total stall time as the psi.total counter, all with
+// "resource" and "type" attributes. Resources the kernel doesn't have a
+// pressure file for are skipped.
+//
+// The returned Registration can be used to unregister the callback.
+func Register(meter metric.Meter, resources ...psi.Resource) (metric.Registration, error) {
+	if len(resources) == 0 {
+		resources = []psi.Resource{
+			psi.ResourceCPU,
+			psi.ResourceIO,
+			psi.ResourceMemory,
+		}
+	}
+
+	var avgs [3]metric.Float64ObservableGauge
+	for i, name := range []string{"psi.avg10", "psi.avg60", "psi.avg300"} {
+		avg, err := meter.Float64ObservableGauge(
+			name,
+			metric.WithUnit("%"),
+			metric.WithDescription("Percentage of time tasks were stalled waiting on the resource."),
+		)
+		if err != nil {
+			return nil, err
+		}
+		avgs[i] = avg
+	}
+
+	total, err := meter.Float64ObservableCounter(
+		"psi.total",
+		metric.WithUnit("s"),
+		metric.WithDescription("Total time tasks were stalled waiting on the resource."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for _, resource := range resources {
+			pressure, err := psi.ReadPressure(resource)
+			if err != nil {
+				if errors.Is(err, psi.ErrPSIUnsupported) {
+					continue
+				}
+				return err
+			}
+
+			observe(o, avgs, total, resource, psi.StallTypeSome, pressure.Some)
+			if pressure.Full != nil {
+				observe(o, avgs, total, resource, psi.StallTypeFull, *pressure.Full)
+			}
+		}
+		return nil
+	}, avgs[0], avgs[1], avgs[2], total)
+}
+
+// observe will record the metrics for one line of a pressure file.
+func observe(
+	o metric.Observer,
+	avgs [3]metric.Float64ObservableGauge,
+	total metric.Float64ObservableCounter,
+	resource psi.Resource,
+	stallType psi.StallType,
+	metrics psi.PressureMetrics,
+) {
+	// A line full of "nan" isn't worth reporting as zeros.
+	if metrics.Unavailable {
+		return
+	}
+	attrs := metric.WithAttributes(
+		attribute.String("resource", string(resource)),
+		attribute.String("type", string(stallType)),
+	)
+	o.ObserveFloat64(avgs[0], metrics.Avg10, attrs)
+	o.ObserveFloat64(avgs[1], metrics.Avg60, attrs)
+	o.ObserveFloat64(avgs[2], metrics.Avg300, attrs)
+	o.ObserveFloat64(total, float64(metrics.Total)/1e6, attrs)
+}
+
+// vim: foldmethod=marker
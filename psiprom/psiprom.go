@@ -0,0 +1,168 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+// Package psiprom exports PSI backpressure as Prometheus metrics.
+//
+// Pressure is read from /proc/pressure when Prometheus scrapes the Collector,
+// so there's no background goroutine to manage. A StatsCollector exports the
+// Stats of a running monitor, such as how many events it's dropped.
+//
+// This is its own module, so that only programs which use it pull in the
+// Prometheus client, rather than everything that uses psi.
+package psiprom
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pault.ag/go/psi"
+)
+
+var (
+	labels = []string{"resource"}
+
+	totalDesc = prometheus.NewDesc(
+		"psi_total_seconds",
+		"Total time tasks were stalled waiting on the resource.",
+		[]string{"resource", "type"},
+		nil,
+	)
+)
+
+// avgDesc will create the Desc for one of the decaying averages, such as
+// psi_some_avg10.
+func avgDesc(stallType psi.StallType, window string) *prometheus.Desc {
+	who := "at least one of the"
+	if stallType == psi.StallTypeFull {
+		who = "all of the"
+	}
+	return prometheus.NewDesc(
+		fmt.Sprintf("psi_%s_avg%s", stallType, window),
+		fmt.Sprintf(
+			"Percentage of time %s tasks were stalled waiting on the resource, averaged over %s seconds.",
+			who,
+			window,
+		),
+		labels,
+		nil,
+	)
+}
+
+// avgDescs are the Descs for the decaying averages of one StallType, in
+// avg10, avg60, avg300 order.
+type avgDescs [3]*prometheus.Desc
+
+func newAvgDescs(stallType psi.StallType) avgDescs {
+	return avgDescs{
+		avgDesc(stallType, "10"),
+		avgDesc(stallType, "60"),
+		avgDesc(stallType, "300"),
+	}
+}
+
+// Collector is a prometheus.Collector that exports the backpressure on
+// ResourceCPU, ResourceIO and ResourceMemory.
+type Collector struct {
+	some avgDescs
+	full avgDescs
+}
+
+// NewCollector will create a new Collector.
+func NewCollector() *Collector {
+	return &Collector{
+		some: newAvgDescs(psi.StallTypeSome),
+		full: newAvgDescs(psi.StallTypeFull),
+	}
+}
+
+// Register will create a new Collector, and register it with the provided
+// Registerer, such as prometheus.DefaultRegisterer.
+func Register(r prometheus.Registerer) error {
+	return r.Register(NewCollector())
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.some {
+		ch <- desc
+	}
+	for _, desc := range c.full {
+		ch <- desc
+	}
+	ch <- totalDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, resource := range []psi.Resource{
+		psi.ResourceCPU,
+		psi.ResourceIO,
+		psi.ResourceMemory,
+	} {
+		pressure, err := psi.ReadPressure(resource)
+		if err != nil {
+			if errors.Is(err, psi.ErrPSIUnsupported) {
+				continue
+			}
+			ch <- prometheus.NewInvalidMetric(totalDesc, err)
+			continue
+		}
+
+		collectMetrics(ch, resource, psi.StallTypeSome, c.some, pressure.Some)
+		// Older kernels don't have a "full" line for ResourceCPU, so
+		// rather than exporting zeros, just leave it out.
+		if pressure.Full != nil {
+			collectMetrics(ch, resource, psi.StallTypeFull, c.full, *pressure.Full)
+		}
+	}
+}
+
+// collectMetrics will send the metrics for one line of a pressure file.
+func collectMetrics(
+	ch chan<- prometheus.Metric,
+	resource psi.Resource,
+	stallType psi.StallType,
+	descs avgDescs,
+	metrics psi.PressureMetrics,
+) {
+	// Likewise, a line full of "nan" isn't worth exporting as zeros.
+	if metrics.Unavailable {
+		return
+	}
+	for i, avg := range []float64{metrics.Avg10, metrics.Avg60, metrics.Avg300} {
+		ch <- prometheus.MustNewConstMetric(
+			descs[i],
+			prometheus.GaugeValue,
+			avg,
+			string(resource),
+		)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		totalDesc,
+		prometheus.CounterValue,
+		float64(metrics.Total)/1e6,
+		string(resource),
+		string(stallType),
+	)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,92 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psiprom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pault.ag/go/psi"
+)
+
+var (
+	statsLabels = []string{"monitor"}
+
+	wakeupsDesc = prometheus.NewDesc(
+		"psi_monitor_wakeups_total",
+		"Times the monitor's trigger fired.",
+		statsLabels,
+		nil,
+	)
+	callbackErrorsDesc = prometheus.NewDesc(
+		"psi_monitor_callback_errors_total",
+		"Times the monitor's callback returned an error or panicked.",
+		statsLabels,
+		nil,
+	)
+	droppedDesc = prometheus.NewDesc(
+		"psi_monitor_dropped_total",
+		"Times the monitor's trigger fired without the callback being invoked.",
+		statsLabels,
+		nil,
+	)
+)
+
+// StatsCollector is a prometheus.Collector that exports the Stats of a
+// running monitor, such as from psi.Handle.Stats, labelled with its name.
+type StatsCollector struct {
+	name  string
+	stats func() psi.Stats
+}
+
+// NewStatsCollector will create a new StatsCollector, which calls stats every
+// time Prometheus scrapes it.
+func NewStatsCollector(name string, stats func() psi.Stats) *StatsCollector {
+	return &StatsCollector{name: name, stats: stats}
+}
+
+// Describe implements prometheus.Collector.
+func (c *StatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- wakeupsDesc
+	ch <- callbackErrorsDesc
+	ch <- droppedDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *StatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+	for _, counter := range []struct {
+		desc  *prometheus.Desc
+		value uint64
+	}{
+		{wakeupsDesc, stats.Wakeups},
+		{callbackErrorsDesc, stats.CallbackErrors},
+		{droppedDesc, stats.Dropped},
+	} {
+		ch <- prometheus.MustNewConstMetric(
+			counter.desc,
+			prometheus.CounterValue,
+			float64(counter.value),
+			c.name,
+		)
+	}
+}
+
+// vim: foldmethod=marker
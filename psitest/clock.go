@@ -0,0 +1,176 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psitest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// Clock is a fake clock for the psi helpers that work on timing:
+// psi.Throttle, Config.MinCallbackInterval, psi.MovingAverage,
+// psi.PollMonitor, psi.LoadShedder, psi.RateMonitor, psi.Samples,
+// psi.WaitForRecovery, psi.MonitorWithRetry, the backoff between
+// Config.ReopenAttempts, psi.Recorder and psi.Replayer. Event.Time and
+// Snapshot.Time come from it too. Time only moves when Advance is called:
+//
+//	clock := psitest.NewClock(time.Unix(0, 0))
+//	defer clock.Install()()
+//	...
+//	clock.BlockUntil(1) // wait for the helper to start its ticker
+//	clock.Advance(time.Second)
+//
+// The clock in use is shared by the whole psi package, so tests installing
+// a Clock can't run in parallel with anything else using psi.
+type Clock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*waiter
+}
+
+// waiter is an After or a Ticker waiting on the Clock.
+type waiter struct {
+	clock  *Clock
+	at     time.Time
+	period time.Duration
+	ch     chan time.Time
+}
+
+// NewClock will return a Clock, starting at the provided time.
+func NewClock(start time.Time) *Clock {
+	c := &Clock{now: start}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Install will make the psi package use this Clock, returning a func that
+// puts back whatever it was using before.
+func (c *Clock) Install() func() {
+	return clock.Set(c)
+}
+
+// Now will return the Clock's current time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After is time.After, but fires once the Clock has been advanced far enough.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &waiter{clock: c, at: c.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.ch <- c.now
+		return w.ch
+	}
+	c.add(w)
+	return w.ch
+}
+
+// NewTicker is time.NewTicker, but ticks as the Clock is advanced. As with a
+// time.Ticker, ticks nobody was around to read are dropped.
+func (c *Clock) NewTicker(d time.Duration) clock.Ticker {
+	if d <= 0 {
+		panic("psitest: non-positive interval for NewTicker")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &waiter{clock: c, at: c.now.Add(d), period: d, ch: make(chan time.Time, 1)}
+	c.add(w)
+	return w
+}
+
+// Advance will move the Clock forward, firing any Afters and Tickers that
+// come due along the way, in order.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end := c.now.Add(d)
+	for len(c.waiters) > 0 && !c.waiters[0].at.After(end) {
+		w := c.waiters[0]
+		c.waiters = c.waiters[1:]
+		c.now = w.at
+		select {
+		case w.ch <- w.at:
+		default:
+		}
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+			c.insert(w)
+		}
+	}
+	c.now = end
+}
+
+// BlockUntil will wait until at least n Afters and Tickers are waiting on
+// the Clock, so that a test can be sure a helper running in another
+// goroutine has got as far as waiting before calling Advance.
+func (c *Clock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+// add will add a waiter, and wake up anyone in BlockUntil. c.mu must be held.
+func (c *Clock) add(w *waiter) {
+	c.insert(w)
+	c.cond.Broadcast()
+}
+
+// insert will put a waiter in its place, keeping them in the order they're
+// due. c.mu must be held.
+func (c *Clock) insert(w *waiter) {
+	i := sort.Search(len(c.waiters), func(i int) bool {
+		return c.waiters[i].at.After(w.at)
+	})
+	c.waiters = append(c.waiters, nil)
+	copy(c.waiters[i+1:], c.waiters[i:])
+	c.waiters[i] = w
+}
+
+// C will return the channel the Ticker ticks on.
+func (w *waiter) C() <-chan time.Time {
+	return w.ch
+}
+
+// Stop will stop the Ticker. Like a time.Ticker, this doesn't close the
+// channel.
+func (w *waiter) Stop() {
+	c := w.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.waiters {
+		if other == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,43 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+// Package psitest fakes out the kernel side of a PSI trigger, so that code
+// built on psi.MonitorTrigger can be tested without real backpressure (or a
+// kernel that supports triggers at all).
+//
+// A Source is handed to psi.NewTriggerFromSource in place of the pressure
+// file, and every call to Fire trips the Trigger as if the kernel had:
+//
+//	source, err := psitest.NewSource("some avg10=1.00 avg60=0.50 avg300=0.10 total=12345\n")
+//	...
+//	trigger, err := psi.NewTriggerFromSource(config, source)
+//	...
+//	go psi.MonitorTrigger(ctx, trigger, cb)
+//	source.Fire()
+//
+// Sources are only available on Linux, like the rest of the monitoring.
+// FakePressure and FakeSomePressure render pressure file contents for
+// fixtures, and work everywhere.
+//
+// Clock stands in for the time package, for testing the helpers that work
+// on timing without waiting around for real.
+package psitest
+
+// vim: foldmethod=marker
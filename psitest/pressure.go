@@ -0,0 +1,55 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psitest
+
+import (
+	"fmt"
+
+	"pault.ag/go/psi"
+)
+
+// FakePressure will render the contents of a pressure file with both "some"
+// and "full" lines, as for ResourceIO and ResourceMemory, which is handy to
+// hand to NewSource, or to write out as a fixture for Config.Path.
+func FakePressure(some, full psi.PressureMetrics) string {
+	return pressureLine(psi.StallTypeSome, some) + pressureLine(psi.StallTypeFull, full)
+}
+
+// FakeSomePressure will render the contents of a pressure file with only a
+// "some" line, as for ResourceCPU on kernels older than 5.13.
+func FakeSomePressure(some psi.PressureMetrics) string {
+	return pressureLine(psi.StallTypeSome, some)
+}
+
+// pressureLine will render a single line of a pressure file, just like the
+// kernel does. Extra fields aren't rendered.
+func pressureLine(stallType psi.StallType, metrics psi.PressureMetrics) string {
+	return fmt.Sprintf(
+		"%s avg10=%.2f avg60=%.2f avg300=%.2f total=%d\n",
+		stallType,
+		metrics.Avg10,
+		metrics.Avg60,
+		metrics.Avg300,
+		metrics.Total,
+	)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,179 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+//go:build linux
+// +build linux
+
+package psitest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// Source is a fake pressure file, which satisfies psi.Source. It reports
+// whatever pressure it's been given, remembers the trigger written to it, and
+// becomes ready for POLLPRI every time Fire is called.
+//
+// Under the hood, this is a loopback TCP connection, since urgent data is
+// about the only portable way to get POLLPRI out of a socket.
+type Source struct {
+	mu       sync.Mutex
+	pressure []byte
+	written  []byte
+
+	file   *os.File // end that gets polled
+	sender *os.File // end Fire sends urgent data from
+
+	closeOnce sync.Once
+}
+
+// NewSource will create a new Source that reports the provided contents of
+// a pressure file, such as "some avg10=0.00 avg60=0.00 avg300=0.00 total=0".
+func NewSource(pressure string) (*Source, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	peer, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	defer peer.Close()
+
+	// File dups the fds, so the net.Conns can be closed once we have them.
+	sender, err := conn.(*net.TCPConn).File()
+	if err != nil {
+		return nil, err
+	}
+	file, err := peer.(*net.TCPConn).File()
+	if err != nil {
+		sender.Close()
+		return nil, err
+	}
+
+	return &Source{
+		pressure: []byte(pressure),
+		file:     file,
+		sender:   sender,
+	}, nil
+}
+
+// SetPressure will change the contents of the fake pressure file, as read by
+// Trigger.Read and the Events passed to an EventCallback.
+func (s *Source) SetPressure(pressure string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pressure = []byte(pressure)
+}
+
+// Written returns everything written to the Source so far, which is the
+// trigger spec (NUL and all) if it came from psi.NewTriggerFromSource.
+func (s *Source) Written() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]byte(nil), s.written...)
+}
+
+// Fire will trip the trigger, making the Source ready for POLLPRI until the
+// event is drained by the poll loop. Like the kernel, firing more than once
+// before that happens may only result in the one event.
+func (s *Source) Fire() error {
+	return unix.Sendto(int(s.sender.Fd()), []byte{1}, unix.MSG_OOB, nil)
+}
+
+// Drain will clear the pending event, as the kernel does when it reports
+// one. This is invoked by the psi poll loop, and doesn't need to be called
+// by hand.
+func (s *Source) Drain() error {
+	fd := int(s.file.Fd())
+	buf := make([]byte, 64)
+	if _, _, err := unix.Recvfrom(fd, buf, unix.MSG_OOB|unix.MSG_DONTWAIT); err != nil && err != unix.EAGAIN && err != unix.EINVAL {
+		return err
+	}
+	// Only the latest urgent byte is kept out of band, so any earlier
+	// ones are sitting in the stream, where they'd eventually fill the
+	// buffer if nobody read them.
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, unix.MSG_DONTWAIT)
+		if err == unix.EAGAIN || (err == nil && n == 0) {
+			// Left to delayed acks, every so often the next Fire
+			// takes 40ms or so to turn up, which is no good for
+			// benchmarks. Quick acks have to be turned back on after
+			// every read.
+			return unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_QUICKACK, 1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ReadAt will read the fake pressure file.
+func (s *Source) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if off >= int64(len(s.pressure)) {
+		return 0, io.EOF
+	}
+	n := copy(p, s.pressure[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Write will record what's written to the Source, for Written.
+func (s *Source) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written = append(s.written, p...)
+	return len(p), nil
+}
+
+// Fd returns the descriptor the poll loop waits on.
+func (s *Source) Fd() uintptr {
+	return s.file.Fd()
+}
+
+// Close will close both ends of the Source. Calling Close again does
+// nothing, and returns nil.
+func (s *Source) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = errors.Join(s.file.Close(), s.sender.Close())
+	})
+	return err
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,100 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// RateMonitor samples the total stall time on a Resource at a fixed
+// interval, to work out what fraction of each interval at least one task was
+// stalled. This tends to be easier to alert on than the kernel's decaying
+// averages.
+type RateMonitor struct {
+	resource Resource
+	interval time.Duration
+
+	primed    bool
+	lastTotal uint64
+	lastTime  time.Time
+}
+
+// NewRateMonitor will create a RateMonitor for the provided Resource, which
+// samples every interval.
+func NewRateMonitor(resource Resource, interval time.Duration) *RateMonitor {
+	return &RateMonitor{
+		resource: resource,
+		interval: interval,
+	}
+}
+
+// sample will read the current total stall time.
+func (r *RateMonitor) sample() (uint64, time.Time, error) {
+	now := clock.Now()
+	pressure, err := ReadPressure(r.resource)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return pressure.Some.Total, now, nil
+}
+
+// Next will block for one interval, and return the fraction of that time
+// (from 0 to 1) that at least one task was stalled on the Resource.
+//
+// The first call has nothing to compare against, so it takes a sample before
+// waiting. Later calls compare against the sample taken by the previous one,
+// so any time spent between calls is counted in the next rate.
+func (r *RateMonitor) Next() (float64, error) {
+	if !r.primed {
+		total, now, err := r.sample()
+		if err != nil {
+			return 0, err
+		}
+		r.lastTotal, r.lastTime, r.primed = total, now, true
+	}
+
+	<-clock.After(r.interval)
+
+	total, now, err := r.sample()
+	if err != nil {
+		return 0, err
+	}
+	lastTotal, lastTime := r.lastTotal, r.lastTime
+	r.lastTotal, r.lastTime = total, now
+
+	// Totals are in microseconds, so anything shorter than that (such as
+	// with a clock that isn't moving) can't say anything about the rate,
+	// and would only divide by zero.
+	elapsed := now.Sub(lastTime)
+	if elapsed < time.Microsecond {
+		return 0, nil
+	}
+
+	rate := float64(deltaTotal(lastTotal, total)) / float64(elapsed.Microseconds())
+	if rate > 1 {
+		rate = 1
+	}
+	return rate, nil
+}
+
+// vim: foldmethod=marker
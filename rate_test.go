@@ -0,0 +1,69 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// creepingClock is a clock.Clock that only moves forward a little every
+// time it's asked the time.
+type creepingClock struct {
+	now  time.Time
+	step time.Duration
+}
+
+func (c *creepingClock) Now() time.Time {
+	c.now = c.now.Add(c.step)
+	return c.now
+}
+
+func (c *creepingClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (c *creepingClock) NewTicker(d time.Duration) clock.Ticker { return clock.Real{}.NewTicker(d) }
+
+func TestRateMonitorSubMicrosecond(t *testing.T) {
+	pressureFixtures(t, map[Resource]string{
+		ResourceCPU: "some avg10=0.00 avg60=0.00 avg300=0.00 total=100\n",
+	})
+	defer clock.Set(&creepingClock{now: time.Unix(1234, 0), step: 500 * time.Nanosecond})()
+
+	rate := NewRateMonitor(ResourceCPU, time.Millisecond)
+	for _, total := range []string{"100", "200"} {
+		contents := "some avg10=0.00 avg60=0.00 avg300=0.00 total=" + total + "\n"
+		if err := os.WriteFile(filepath.Join(pressureRoot, "cpu"), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := rate.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != 0 {
+			t.Fatalf("Next() with total=%s = %v, want 0", total, got)
+		}
+	}
+}
+
+// vim: foldmethod=marker
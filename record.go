@@ -0,0 +1,204 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// Recordings are JSON Lines: a header line, followed by one Snapshot per
+// line, such as:
+//
+//	{"format":"psi-recording","version":1}
+//	{"resource":"cpu","time":"2019-12-01T12:00:00Z","some":{"avg10":0.12,"avg60":0.05,"avg300":0.01,"total":1234}}
+//	{"resource":"io","time":"2019-12-01T12:00:00Z","some":{...},"full":{...}}
+//
+// The version is bumped if the format ever changes in a way older readers
+// can't cope with.
+const (
+	recordingFormat  = "psi-recording"
+	recordingVersion = 1
+)
+
+// recordingHeader is the first line of a recording.
+type recordingHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+// Recorder samples the pressure on some Resources at a fixed interval, and
+// writes each Snapshot out as a line of JSON, for replaying later with a
+// Replayer, or for analysis offline.
+type Recorder struct {
+	w         io.Writer
+	interval  time.Duration
+	resources []Resource
+}
+
+// NewRecorder will create a Recorder that writes to w every interval, for
+// each of the provided Resources, or all of ResourceCPU, ResourceIO and
+// ResourceMemory if none are provided. Nothing is written until Run is
+// called.
+func NewRecorder(w io.Writer, interval time.Duration, resources ...Resource) *Recorder {
+	return &Recorder{w: w, interval: interval, resources: resources}
+}
+
+// Run will write the recording header, and then a Snapshot of each Resource
+// every interval (starting right away), until the context is cancelled, in
+// which case ctx.Err() is returned, or sampling or writing fails.
+func (r *Recorder) Run(ctx context.Context) error {
+	sampler, err := NewSampler(r.resources...)
+	if err != nil {
+		return err
+	}
+	defer sampler.Close()
+
+	encoder := json.NewEncoder(r.w)
+	if err := encoder.Encode(recordingHeader{
+		Format:  recordingFormat,
+		Version: recordingVersion,
+	}); err != nil {
+		return err
+	}
+
+	ticker := clock.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		snapshots, err := sampler.Sample()
+		if err != nil {
+			return err
+		}
+		for _, snapshot := range snapshots {
+			if err := encoder.Encode(snapshot); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C():
+		}
+	}
+}
+
+// Replayer reads back a recording written by a Recorder.
+type Replayer struct {
+	scanner *bufio.Scanner
+
+	// Speed is how fast Replay plays the recording back, relative to how
+	// fast it was recorded; 2 is twice as fast. If 0 (or less), Replay
+	// doesn't wait between Snapshots at all.
+	Speed float64
+}
+
+// NewReplayer will create a Replayer for the recording read from r, checking
+// that it starts with a recording header we know how to read.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("psi: empty recording")
+	}
+
+	var header recordingHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, fmt.Errorf("psi: bad recording header: %w", err)
+	}
+	if header.Format != recordingFormat {
+		return nil, fmt.Errorf("psi: not a recording (format %q)", header.Format)
+	}
+	if header.Version < 1 || header.Version > recordingVersion {
+		return nil, fmt.Errorf("psi: unsupported recording version %d", header.Version)
+	}
+
+	return &Replayer{scanner: scanner, Speed: 1}, nil
+}
+
+// Next will return the next Snapshot in the recording, or io.EOF once there
+// aren't any more.
+func (r *Replayer) Next() (Snapshot, error) {
+	for r.scanner.Scan() {
+		line := r.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var snapshot Snapshot
+		if err := json.Unmarshal(line, &snapshot); err != nil {
+			return Snapshot{}, fmt.Errorf("psi: bad snapshot in recording: %w", err)
+		}
+		return snapshot, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{}, io.EOF
+}
+
+// Replay will invoke the callback with each Snapshot in the recording, in
+// order, waiting between them for as long as passed between them when they
+// were recorded (scaled by Speed), as if they were happening now.
+//
+// Replay returns nil once the recording is over, or if the callback returns
+// ErrStopMonitoring. If the context is cancelled, ctx.Err() is returned.
+func (r *Replayer) Replay(ctx context.Context, cb func(Snapshot) error) error {
+	var last time.Time
+	for {
+		snapshot, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if r.Speed > 0 && !last.IsZero() && snapshot.Time.After(last) {
+			wait := time.Duration(float64(snapshot.Time.Sub(last)) / r.Speed)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-clock.After(wait):
+			}
+		}
+		last = snapshot.Time
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := cb(snapshot); err != nil {
+			if err == ErrStopMonitoring {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// vim: foldmethod=marker
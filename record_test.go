@@ -0,0 +1,141 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+func TestRecordReplay(t *testing.T) {
+	pressureFixtures(t, map[Resource]string{
+		ResourceCPU: "some avg10=0.12 avg60=0.05 avg300=0.01 total=1234\n",
+		ResourceIO: "some avg10=1.00 avg60=2.00 avg300=3.00 total=456\n" +
+			"full avg10=0.50 avg60=1.00 avg300=1.50 total=78\n",
+	})
+	now := time.Date(2019, 12, 1, 12, 0, 0, 0, time.UTC)
+	defer clock.Set(fixedClock{now})()
+
+	// With the context already done, Run records one round of Snapshots
+	// and stops.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var buf bytes.Buffer
+	if err := NewRecorder(&buf, time.Second, ResourceCPU, ResourceIO).Run(ctx); err != context.Canceled {
+		t.Fatalf("Run() = %v, want context.Canceled", err)
+	}
+
+	replayer, err := NewReplayer(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Snapshot{
+		{
+			Resource: ResourceCPU,
+			Time:     now,
+			Some:     PressureMetrics{Avg10: 0.12, Avg60: 0.05, Avg300: 0.01, Total: 1234},
+		},
+		{
+			Resource: ResourceIO,
+			Time:     now,
+			Some:     PressureMetrics{Avg10: 1, Avg60: 2, Avg300: 3, Total: 456},
+			Full:     &PressureMetrics{Avg10: 0.5, Avg60: 1, Avg300: 1.5, Total: 78},
+		},
+	}
+	if got := replayAll(t, replayer); !reflect.DeepEqual(got, want) {
+		t.Fatalf("replayed %+v, want %+v", got, want)
+	}
+}
+
+func TestReplayV1(t *testing.T) {
+	replayer, err := NewReplayer(strings.NewReader(`{"format":"psi-recording","version":1}
+{"resource":"cpu","time":"2019-12-01T12:00:00Z","some":{"avg10":0.12,"avg60":0.05,"avg300":0.01,"total":1234}}
+
+{"resource":"memory","time":"2019-12-01T12:00:01Z","some":{"avg10":1,"avg60":0,"avg300":0,"total":5},"full":{"avg10":0.5,"avg60":0,"avg300":0,"total":2}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer.Speed = 0
+
+	start := time.Date(2019, 12, 1, 12, 0, 0, 0, time.UTC)
+	want := []Snapshot{
+		{
+			Resource: ResourceCPU,
+			Time:     start,
+			Some:     PressureMetrics{Avg10: 0.12, Avg60: 0.05, Avg300: 0.01, Total: 1234},
+		},
+		{
+			Resource: ResourceMemory,
+			Time:     start.Add(time.Second),
+			Some:     PressureMetrics{Avg10: 1, Total: 5},
+			Full:     &PressureMetrics{Avg10: 0.5, Total: 2},
+		},
+	}
+	var got []Snapshot
+	if err := replayer.Replay(context.Background(), func(snapshot Snapshot) error {
+		got = append(got, snapshot)
+		return nil
+	}); err != nil {
+		t.Fatalf("Replay() = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("replayed %+v, want %+v", got, want)
+	}
+}
+
+func TestReplayBadHeader(t *testing.T) {
+	for _, header := range []string{
+		"",
+		"not json\n",
+		`{"format":"something-else","version":1}` + "\n",
+		`{"format":"psi-recording","version":2}` + "\n",
+	} {
+		if _, err := NewReplayer(strings.NewReader(header)); err == nil {
+			t.Errorf("NewReplayer(%q) didn't fail", header)
+		}
+	}
+}
+
+// replayAll will read every Snapshot left in the recording.
+func replayAll(t *testing.T, replayer *Replayer) []Snapshot {
+	t.Helper()
+	var snapshots []Snapshot
+	for {
+		snapshot, err := replayer.Next()
+		if err == io.EOF {
+			return snapshots
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,106 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// WaitForRecovery will read the pressure on the provided Resource every
+// interval (starting right away), and return nil once the metric is below the
+// threshold. The kernel only says when pressure goes up past a trigger's
+// threshold, not when it comes back down, so this has to poll. Paired with
+// WaitForStall, this makes for a shed/recover loop:
+//
+//	for {
+//		if _, err := psi.WaitForStall(ctx, config); err != nil { ... }
+//		shed()
+//		if err := psi.WaitForRecovery(ctx, config.Resource, 5, nil, time.Second); err != nil { ... }
+//		recover()
+//	}
+//
+// The metric is handed the "some" line of each read; if it's nil, the Avg10
+// is used. If the context is done first, ctx.Err() is returned (not
+// ErrTimeout, which is about stalls that never came). Errors reading the
+// pressure are returned as-is.
+func WaitForRecovery(
+	ctx context.Context,
+	resource Resource,
+	below float64,
+	metric func(PressureMetrics) float64,
+	interval time.Duration,
+) error {
+	return WaitForRecoverySamples(ctx, resource, below, metric, interval, 1)
+}
+
+// WaitForRecoverySamples is WaitForRecovery, but the metric has to be below
+// the threshold for n samples in a row, so that one quiet sample in the
+// middle of a stall isn't taken for recovery.
+func WaitForRecoverySamples(
+	ctx context.Context,
+	resource Resource,
+	below float64,
+	metric func(PressureMetrics) float64,
+	interval time.Duration,
+	n int,
+) error {
+	if interval <= 0 {
+		return fmt.Errorf("psi: recovery interval must be more than 0, not %s", interval)
+	}
+	if metric == nil {
+		metric = func(m PressureMetrics) float64 { return m.Avg10 }
+	}
+
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	quiet := 0
+	for {
+		pressure, err := ReadPressure(resource)
+		if err != nil {
+			return err
+		}
+		switch {
+		case pressure.Some.Unavailable:
+			// No numbers is no sign of recovery, but it's no sign of
+			// pressure either, so this sample just doesn't count.
+		case metric(pressure.Some) < below:
+			quiet++
+			if quiet >= n {
+				return nil
+			}
+		default:
+			quiet = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C():
+		}
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,97 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// RetryPolicy is how MonitorWithRetry retries setting up the trigger.
+type RetryPolicy struct {
+	// MaxAttempts is how many times to try setting the trigger up, all
+	// told. 0 (or 1) means no retries.
+	MaxAttempts int
+
+	// Backoff is how long to wait before the first retry. Each retry after
+	// that waits twice as long as the one before, up to MaxBackoff.
+	Backoff time.Duration
+
+	// MaxBackoff, if set, is the longest to wait between attempts.
+	MaxBackoff time.Duration
+}
+
+// MonitorWithRetry is Monitor, but retries setting up the trigger according
+// to the RetryPolicy if it fails in a way that might go away on its own, such
+// as the cgroup not having been created yet. Only setting up the trigger is
+// retried; once it's set up, this is just Monitor, and the Config's
+// ReopenAttempts applies as usual.
+//
+// Failures that are retried are the pressure file not existing (ENOENT,
+// unless it's the system-wide pressure file, in which case the kernel just
+// doesn't have PSI), and EAGAIN. Anything else is returned right away, as is
+// the last error once MaxAttempts is used up.
+func MonitorWithRetry(config Config, cb MonitorCallback, policy RetryPolicy) error {
+	if err := config.Check(); err != nil {
+		return err
+	}
+
+	var (
+		trigger *Trigger
+		err     error
+		backoff = policy.Backoff
+	)
+	for attempt := 1; ; attempt++ {
+		trigger, err = openTrigger(config)
+		if err == nil {
+			break
+		}
+		if attempt >= policy.MaxAttempts || !retryable(err) {
+			return err
+		}
+		config.logger().Warn(
+			"psi: retrying trigger setup",
+			config.logArgs("attempt", attempt, "err", err)...,
+		)
+		<-clock.After(backoff)
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+
+	return run(context.Background(), trigger, func(*Trigger, wakeup) error { return cb() })
+}
+
+// retryable will return true if an error setting up a trigger is worth
+// trying again.
+func retryable(err error) bool {
+	if errors.Is(err, ErrPSIUnsupported) {
+		return false
+	}
+	return errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.EAGAIN)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,70 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+//go:build go1.23
+// +build go1.23
+
+package psi
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// Samples will read the backpressure on the provided Resource every interval
+// (starting right away), for ranging over:
+//
+//	for pressure, err := range psi.Samples(ctx, psi.ResourceMemory, time.Second) {
+//		...
+//	}
+//
+// Iteration stops once the context is done, or the loop breaks. Errors
+// reading the pressure are yielded along with a zero Pressure, and don't stop
+// iteration by themselves. An interval that isn't more than 0 is yielded as
+// an error, once, and that's all. This needs Go 1.23 or newer.
+func Samples(ctx context.Context, resource Resource, interval time.Duration) iter.Seq2[Pressure, error] {
+	return func(yield func(Pressure, error) bool) {
+		if interval <= 0 {
+			yield(Pressure{}, fmt.Errorf("psi: sample interval must be more than 0, not %s", interval))
+			return
+		}
+		ticker := clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			if !yield(ReadPressure(resource)) {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}
+}
+
+// vim: foldmethod=marker
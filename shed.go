@@ -0,0 +1,148 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// LoadShedder is the usual control loop for admission control under
+// backpressure: it calls onShed when the trigger for its Config trips, and
+// once the pressure has died back down, onRecover.
+//
+// The kernel only tells us when pressure goes up, so while shedding, the
+// LoadShedder reads the pressure every RecoverInterval to find out when it's
+// gone back down. The "some" or "full" Avg10 (whichever the Config's Type
+// is) has to drop below RecoverBelow, and the LoadShedder has to have been
+// shedding for at least MinShedDuration, before onRecover is called, so that
+// pressure hovering around the threshold doesn't flap.
+type LoadShedder struct {
+	// RecoverBelow is the percentage (from 0 to 100) the Avg10 has to drop
+	// below to recover. NewLoadShedder sets this to half of the trigger's
+	// threshold, which is StallWindowDuration as a percentage of the
+	// WindowDuration.
+	RecoverBelow float64
+
+	// MinShedDuration is the least amount of time to shed load for, once
+	// shedding starts. NewLoadShedder sets this to the WindowDuration.
+	MinShedDuration time.Duration
+
+	// RecoverInterval is how often to read the pressure while shedding.
+	// NewLoadShedder sets this to 2s, which is how often the kernel
+	// updates the averages. This replaces the Config's PollTimeout.
+	RecoverInterval time.Duration
+
+	config    Config
+	onShed    func()
+	onRecover func()
+
+	shedding  atomic.Bool
+	shedSince time.Time
+}
+
+// NewLoadShedder will create a LoadShedder for the provided Config, which
+// invokes onShed when its trigger trips, and onRecover when the pressure has
+// gone back down. Neither is invoked twice in a row. Nothing happens until
+// Run is called.
+func NewLoadShedder(config Config, onShed, onRecover func()) *LoadShedder {
+	threshold := 0.0
+	if config.WindowDuration > 0 {
+		threshold = 100 * float64(config.StallWindowDuration) / float64(config.WindowDuration)
+	}
+	return &LoadShedder{
+		RecoverBelow:    threshold / 2,
+		MinShedDuration: config.WindowDuration,
+		RecoverInterval: 2 * time.Second,
+		config:          config,
+		onShed:          onShed,
+		onRecover:       onRecover,
+	}
+}
+
+// Shedding will return true if the LoadShedder is currently shedding load,
+// which is to say, onShed has been called, and onRecover hasn't since.
+func (l *LoadShedder) Shedding() bool {
+	return l.shedding.Load()
+}
+
+// Run will monitor the pressure, shedding load and recovering as it goes up
+// and down, until the context is cancelled (in which case ctx.Err() is
+// returned) or something goes wrong. The Config's FireOnStart is ignored,
+// since shedding load should wait for an actual stall.
+func (l *LoadShedder) Run(ctx context.Context) error {
+	config := l.config
+	config.FireOnStart = false
+	config.PollTimeout = l.RecoverInterval
+	onTick := config.OnTick
+	config.OnTick = func() error {
+		if err := l.maybeRecover(); err != nil {
+			return err
+		}
+		if onTick != nil {
+			return onTick()
+		}
+		return nil
+	}
+
+	return MonitorContext(ctx, config, func() error {
+		if !l.shedding.Load() {
+			l.shedSince = clock.Now()
+			l.shedding.Store(true)
+			l.onShed()
+			return nil
+		}
+		// Under sustained pressure, the trigger keeps firing, and we
+		// may never get a tick in, so check here too.
+		return l.maybeRecover()
+	})
+}
+
+// maybeRecover will check if the pressure has gone down enough to stop
+// shedding load, and if so, invoke onRecover.
+func (l *LoadShedder) maybeRecover() error {
+	if !l.shedding.Load() || clock.Since(l.shedSince) < l.MinShedDuration {
+		return nil
+	}
+
+	pressure, err := l.config.ReadPressure()
+	if err != nil {
+		return err
+	}
+	metrics := pressure.Some
+	if l.config.Type == StallTypeFull && pressure.Full != nil {
+		metrics = *pressure.Full
+	}
+	// Without any numbers, there's no telling if we've recovered, so keep
+	// shedding until there are some.
+	if metrics.Unavailable || metrics.Avg10 >= l.RecoverBelow {
+		return nil
+	}
+
+	l.shedding.Store(false)
+	l.onRecover()
+	return nil
+}
+
+// vim: foldmethod=marker
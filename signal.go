@@ -0,0 +1,55 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// MonitorSignals is like Monitor, but will stop monitoring (and close the
+// trigger) when the process gets one of the provided signals, returning nil,
+// for daemons that want to shut down cleanly. If no signals are provided,
+// SIGINT and SIGTERM are used.
+//
+// The signals are only handled while MonitorSignals is running; once it
+// returns, they go back to whatever they were doing before. A signal that
+// comes in at any point, even right before waiting on the trigger, stops
+// the monitor; there's no window where one can be missed.
+func MonitorSignals(config Config, cb MonitorCallback, sigs ...os.Signal) error {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), sigs...)
+	defer stop()
+
+	err := MonitorContext(ctx, config, cb)
+	if err != nil && err == ctx.Err() {
+		// The only way the context is done is a signal.
+		return nil
+	}
+	return err
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,176 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// Snapshot is the backpressure on a Resource at a point in time, which
+// encodes cleanly to JSON for feeding into log pipelines. The averages are
+// encoded as numbers (percentages), and the totals as a number of
+// microseconds, such as:
+//
+//	{
+//	  "resource": "memory",
+//	  "time": "2019-12-01T12:00:00Z",
+//	  "some": {"avg10": 0.12, "avg60": 0.05, "avg300": 0.01, "total": 1234},
+//	  "full": {"avg10": 0, "avg60": 0, "avg300": 0, "total": 56}
+//	}
+type Snapshot struct {
+	Resource Resource         `json:"resource"`
+	Time     time.Time        `json:"time"`
+	Some     PressureMetrics  `json:"some"`
+	Full     *PressureMetrics `json:"full,omitempty"`
+}
+
+// String will render the Snapshot on one line, like Pressure.String, but
+// starting with the Resource, such as "cpu some avg10=0.12 avg60=0.05
+// avg300=0.01 total=1.2s".
+func (s Snapshot) String() string {
+	buf := make([]byte, 0, 128)
+	buf = append(buf, s.Resource...)
+	buf = append(buf, ' ')
+	return string(Pressure{Some: s.Some, Full: s.Full}.appendTo(buf))
+}
+
+// Sample will read the backpressure on each of the provided Resources, or
+// all of ResourceCPU, ResourceIO and ResourceMemory if none are provided,
+// returning a Snapshot of each, in the same order.
+func Sample(resources ...Resource) ([]Snapshot, error) {
+	if len(resources) == 0 {
+		resources = knownResources
+	}
+
+	snapshots := make([]Snapshot, 0, len(resources))
+	for _, resource := range resources {
+		now := clock.Now()
+		pressure, err := ReadPressure(resource)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, Snapshot{
+			Resource: resource,
+			Time:     now,
+			Some:     pressure.Some,
+			Full:     pressure.Full,
+		})
+	}
+	return snapshots, nil
+}
+
+// ReadAll will read the backpressure on each of ResourceCPU, ResourceIO and
+// ResourceMemory, returning the Pressure on each one that could be read.
+//
+// Resources that can't be read (including those whose pressure file is
+// missing, which will match ErrPSIUnsupported) are left out of the map, and
+// don't stop the rest from being read. If there are any, the returned error
+// is a *ReadAllError, which has the error for each of them.
+func ReadAll() (map[Resource]Pressure, error) {
+	pressures := make(map[Resource]Pressure, len(knownResources))
+	var errs map[Resource]error
+	for _, resource := range knownResources {
+		pressure, err := ReadPressure(resource)
+		if err != nil {
+			if errs == nil {
+				errs = map[Resource]error{}
+			}
+			errs[resource] = err
+			continue
+		}
+		pressures[resource] = pressure
+	}
+	if errs != nil {
+		return pressures, &ReadAllError{Errors: errs}
+	}
+	return pressures, nil
+}
+
+// Sampler keeps pressure files open, so they can be read over and over again
+// (such as by a metrics agent scraping every second) without opening them
+// each time.
+type Sampler struct {
+	resources []Resource
+	files     []*os.File
+	closeOnce sync.Once
+}
+
+// NewSampler will open the pressure files for each of the provided
+// Resources, or all of ResourceCPU, ResourceIO and ResourceMemory if none are
+// provided. The files stay open until the Sampler is closed.
+func NewSampler(resources ...Resource) (*Sampler, error) {
+	if len(resources) == 0 {
+		resources = knownResources
+	}
+
+	s := &Sampler{resources: resources}
+	for _, resource := range resources {
+		config := Config{Resource: resource}
+		fd, err := config.open(os.O_RDONLY)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.files = append(s.files, fd)
+	}
+	return s, nil
+}
+
+// Sample will read the backpressure on each of the Sampler's Resources,
+// returning a Snapshot of each, in the same order they were passed to
+// NewSampler.
+func (s *Sampler) Sample() ([]Snapshot, error) {
+	snapshots := make([]Snapshot, 0, len(s.files))
+	for i, fd := range s.files {
+		now := clock.Now()
+		pressure, err := readPressureAt(fd)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, Snapshot{
+			Resource: s.resources[i],
+			Time:     now,
+			Some:     pressure.Some,
+			Full:     pressure.Full,
+		})
+	}
+	return snapshots, nil
+}
+
+// Close will close the Sampler's pressure files. Calling Close again does
+// nothing, and returns nil.
+func (s *Sampler) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		for _, fd := range s.files {
+			if cerr := fd.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,87 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReadAllMissing(t *testing.T) {
+	pressureFixtures(t, map[Resource]string{
+		ResourceCPU: "some avg10=1.00 avg60=0.00 avg300=0.00 total=1\n",
+		ResourceMemory: "some avg10=2.00 avg60=0.00 avg300=0.00 total=2\n" +
+			"full avg10=3.00 avg60=0.00 avg300=0.00 total=3\n",
+	})
+
+	pressures, err := ReadAll()
+	var readAllErr *ReadAllError
+	if !errors.As(err, &readAllErr) {
+		t.Fatalf("ReadAll() = %v, want a *ReadAllError", err)
+	}
+	if len(readAllErr.Errors) != 1 || !errors.Is(readAllErr.Errors[ResourceIO], ErrPSIUnsupported) {
+		t.Fatalf("ReadAllError.Errors = %v, want just io unsupported", readAllErr.Errors)
+	}
+	if !errors.Is(err, ErrPSIUnsupported) {
+		t.Fatalf("ReadAll() = %v, want it to match ErrPSIUnsupported", err)
+	}
+
+	if len(pressures) != 2 {
+		t.Fatalf("ReadAll() read %d Resources, want 2", len(pressures))
+	}
+	if pressures[ResourceCPU].Some.Avg10 != 1 || pressures[ResourceMemory].Full.Avg10 != 3 {
+		t.Fatalf("ReadAll() = %v", pressures)
+	}
+}
+
+// BenchmarkReadAll opens each pressure file every time it reads it, for
+// comparison with BenchmarkSampler.
+func BenchmarkReadAll(b *testing.B) {
+	if _, err := ReadAll(); err != nil {
+		b.Skip(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ReadAll(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSampler keeps each pressure file open, and reads them again each
+// time.
+func BenchmarkSampler(b *testing.B) {
+	sampler, err := NewSampler()
+	if err != nil {
+		b.Skip(err)
+	}
+	defer sampler.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sampler.Sample(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// vim: foldmethod=marker
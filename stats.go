@@ -0,0 +1,115 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"sync/atomic"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// Stats are counters kept on a running monitor, for dashboards and the like.
+type Stats struct {
+	// Wakeups is how many times the trigger has fired, including any
+	// dropped by MinCallbackInterval.
+	Wakeups uint64
+
+	// CallbackErrors is how many times the callback returned an error
+	// (other than ErrStopMonitoring), or panicked with RecoverPanics set.
+	CallbackErrors uint64
+
+	// Dropped is how many times the trigger fired without the callback
+	// acting on it, either because of MinCallbackInterval, or because the
+	// callback returned ErrDropped (as Throttle does).
+	Dropped uint64
+
+	// LastEvent is when the trigger last fired, or the zero time if it
+	// hasn't yet.
+	LastEvent time.Time
+}
+
+// monitorStats is where a monitor keeps the counters for its Stats, which
+// are updated atomically, so they can be read while it's running.
+type monitorStats struct {
+	wakeups        atomic.Uint64
+	callbackErrors atomic.Uint64
+	dropped        atomic.Uint64
+	lastEvent      atomic.Int64
+}
+
+// snapshot will return the current Stats.
+func (s *monitorStats) snapshot() Stats {
+	stats := Stats{
+		Wakeups:        s.wakeups.Load(),
+		CallbackErrors: s.callbackErrors.Load(),
+		Dropped:        s.dropped.Load(),
+	}
+	if last := s.lastEvent.Load(); last != 0 {
+		stats.LastEvent = time.Unix(0, last)
+	}
+	return stats
+}
+
+// countWakeups will wrap a callback so that every call is counted as the
+// trigger firing.
+func (s *monitorStats) countWakeups(cb func() error) func() error {
+	return func() error {
+		s.wakeups.Add(1)
+		s.lastEvent.Store(clock.Now().UnixNano())
+		return cb()
+	}
+}
+
+// countDropped will count a wakeup dropped by MinCallbackInterval.
+func (s *monitorStats) countDropped() {
+	s.dropped.Add(1)
+}
+
+// countDroppedErrors will wrap a callback so that ErrDropped is counted as
+// a dropped event (if there's anywhere to count it), and not returned as an
+// error.
+func (s *monitorStats) countDroppedErrors(cb func() error) func() error {
+	return func() error {
+		err := cb()
+		if err == ErrDropped {
+			if s != nil {
+				s.countDropped()
+			}
+			return nil
+		}
+		return err
+	}
+}
+
+// countErrors will wrap a callback so that every error it returns is
+// counted.
+func (s *monitorStats) countErrors(cb func() error) func() error {
+	return func() error {
+		err := cb()
+		if err != nil && err != ErrStopMonitoring {
+			s.callbackErrors.Add(1)
+		}
+		return err
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,80 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"testing"
+	"time"
+
+	"pault.ag/go/psi/internal/clock"
+)
+
+// fixedClock is a clock.Clock that's always at the same time.
+type fixedClock struct{ now time.Time }
+
+func (c fixedClock) Now() time.Time                         { return c.now }
+func (c fixedClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (c fixedClock) NewTicker(d time.Duration) clock.Ticker { return clock.Real{}.NewTicker(d) }
+
+func TestStatsSkipInitial(t *testing.T) {
+	now := time.Unix(1234, 0)
+	defer clock.Set(fixedClock{now})()
+
+	config := Config{stats: &monitorStats{}}
+	fire, fireInitial := config.wrapCallback(func() error { return nil })
+
+	fireInitial()
+	if stats := config.stats.snapshot(); stats.Wakeups != 0 || !stats.LastEvent.IsZero() {
+		t.Fatalf("Stats after the initial call = %+v, want nothing", stats)
+	}
+
+	fire()
+	stats := config.stats.snapshot()
+	if stats.Wakeups != 1 {
+		t.Fatalf("Wakeups = %d, want 1", stats.Wakeups)
+	}
+	if !stats.LastEvent.Equal(now) {
+		t.Fatalf("LastEvent = %s, want %s", stats.LastEvent, now)
+	}
+}
+
+func TestStatsThrottleDropped(t *testing.T) {
+	config := Config{stats: &monitorStats{}}
+	calls := 0
+	fire, _ := config.wrapCallback(Throttle(2, time.Hour, func() error {
+		calls++
+		return nil
+	}))
+
+	for i := 0; i < 2; i++ {
+		if err := fire(); err != nil {
+			t.Fatalf("fire() = %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("callback invoked %d times, want 1", calls)
+	}
+	if stats := config.stats.snapshot(); stats.Dropped != 1 || stats.CallbackErrors != 0 {
+		t.Fatalf("Stats = %+v, want 1 dropped and no errors", stats)
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,115 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Status is how much PSI the running kernel has going for it, as reported by
+// ProbeStatus.
+type Status int
+
+const (
+	// StatusUnsupported means the kernel was built without CONFIG_PSI (or
+	// this isn't Linux at all).
+	StatusUnsupported Status = iota
+
+	// StatusDisabled means the kernel supports PSI, but it was turned off
+	// at boot, with psi=0 on the kernel command line (or by building with
+	// CONFIG_PSI_DEFAULT_DISABLED, and not passing psi=1).
+	StatusDisabled
+
+	// StatusEnabled means pressure is being tracked, and can be read.
+	StatusEnabled
+)
+
+// String will return the name of the Status, such as "enabled".
+func (s Status) String() string {
+	switch s {
+	case StatusUnsupported:
+		return "unsupported"
+	case StatusDisabled:
+		return "disabled"
+	case StatusEnabled:
+		return "enabled"
+	}
+	return "unknown"
+}
+
+// ProbeStatus will work out whether the kernel supports PSI, and if it does,
+// whether it's been enabled, to help figure out why Available is false.
+//
+// The kernel doesn't create the pressure files at all when PSI is off, so
+// all there is to go on when they're missing is the kernel command line. If
+// psi=0 (or the like) isn't there, the kernel may still have been built with
+// CONFIG_PSI_DEFAULT_DISABLED, which is reported as StatusUnsupported, since
+// there's no telling the two apart from here.
+//
+// StatusEnabled only means pressure can be read; it doesn't mean triggers
+// can be set up, which needs a 5.2 kernel, and maybe CAP_SYS_RESOURCE. Use
+// Probe for that.
+func ProbeStatus() Status {
+	pressure, err := ReadPressure(ResourceCPU)
+	if err == nil && !pressure.Some.Unavailable {
+		return StatusEnabled
+	}
+	if errors.Is(err, ErrUnsupported) {
+		return StatusUnsupported
+	}
+	// The missing file comes back wrapped up as ErrPSIUnsupported, which
+	// os.IsNotExist doesn't see through, so this has to be errors.Is.
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		// The files are there, but don't have anything useful in them.
+		return StatusDisabled
+	}
+	if bootDisabled() {
+		return StatusDisabled
+	}
+	return StatusUnsupported
+}
+
+// bootDisabled will return true if the kernel command line turns PSI off.
+func bootDisabled() bool {
+	fd, err := openFile("/proc/cmdline", os.O_RDONLY)
+	if err != nil {
+		return false
+	}
+	defer fd.Close()
+
+	cmdline, err := io.ReadAll(fd)
+	if err != nil {
+		return false
+	}
+	for _, arg := range strings.Fields(string(cmdline)) {
+		switch strings.ToLower(arg) {
+		case "psi=0", "psi=n", "psi=no", "psi=off", "psi=false":
+			return true
+		}
+	}
+	return false
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,136 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+package psi
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Source is what a Trigger sits on top of. For triggers set up by NewTrigger,
+// this is the pressure file itself, but anything that looks enough like one
+// can be handed to NewTriggerFromSource, which is mostly handy for faking out
+// the kernel in tests (see the psitest package).
+//
+// The trigger spec is written to the Source once, with Write; the current
+// pressure is read from it with ReadAt, at offset 0; and Fd is polled for
+// POLLPRI to wait for the trigger to trip.
+//
+// The kernel clears the event as part of the poll that reports it. Sources
+// that can't do that should have a `Drain() error` method, which is called
+// after every event is reported, before the callback is invoked.
+type Source interface {
+	io.ReaderAt
+	io.Writer
+	io.Closer
+
+	// Fd returns the descriptor to poll.
+	Fd() uintptr
+}
+
+// drainer is a Source that needs to be told an event has been seen.
+type drainer interface {
+	Drain() error
+}
+
+// Trigger is a PSI trigger registered with the kernel, for those who'd
+// rather wait on it in their own poll or epoll loop than use Monitor.
+//
+// The Trigger's fd becomes ready for POLLPRI (EPOLLPRI, if using epoll)
+// every time the backpressure thresholds exceed the Config it was set up
+// with. The kernel clears the event as part of the poll that reports it, so
+// there's nothing to drain.
+type Trigger struct {
+	config Config
+	source Source
+
+	// fromSource is set if the Trigger didn't come from openTrigger, in
+	// which case there's no file we can reopen.
+	fromSource bool
+
+	closeOnce sync.Once
+}
+
+// NewTrigger will Check the provided Config, and register a trigger for it
+// with the kernel. The trigger stays around until the Trigger is closed.
+func NewTrigger(config Config) (*Trigger, error) {
+	if err := config.Check(); err != nil {
+		return nil, err
+	}
+	return openTrigger(config)
+}
+
+// NewTriggerFromSource will Check the provided Config, and set up a trigger
+// for it on the provided Source rather than on the pressure file. The Source
+// is closed when the Trigger is. Since there's no telling how to get the
+// Source back, these Triggers are never reopened, whatever ReopenAttempts is.
+func NewTriggerFromSource(config Config, source Source) (*Trigger, error) {
+	if err := config.Check(); err != nil {
+		return nil, err
+	}
+	trigger := config.TriggerSpec()
+	if _, err := source.Write(config.triggerBytes()); err != nil {
+		return nil, &TriggerError{Config: config, Trigger: trigger, Err: err}
+	}
+	return &Trigger{config: config, source: source, fromSource: true}, nil
+}
+
+// MonitorTrigger will watch an already set up Trigger, invoking the
+// EventCallback every time it trips, just like MonitorEventsContext. The
+// Trigger is closed when MonitorTrigger returns.
+func MonitorTrigger(ctx context.Context, trigger *Trigger, cb EventCallback) error {
+	return run(ctx, trigger, func(trigger *Trigger, wake wakeup) error {
+		event, err := newEvent(trigger, wake)
+		if err != nil {
+			return err
+		}
+		return cb(event)
+	})
+}
+
+// Config returns the Config the Trigger was set up with.
+func (t *Trigger) Config() Config {
+	return t.config
+}
+
+// Fd returns the Trigger's file descriptor, to wait on for POLLPRI. The fd
+// is owned by the Trigger, and is only valid until the Trigger is closed.
+func (t *Trigger) Fd() int {
+	return int(t.source.Fd())
+}
+
+// Read will read the current backpressure on the Trigger's Resource, using
+// the Trigger's own fd rather than opening the pressure file again.
+func (t *Trigger) Read() (Pressure, error) {
+	return readPressureAt(t.source)
+}
+
+// Close will close the Trigger, which unregisters it with the kernel. It's
+// fine to call Close more than once; only the first call does anything, and
+// the rest return nil.
+func (t *Trigger) Close() error {
+	var err error
+	t.closeOnce.Do(func() { err = t.source.Close() })
+	return err
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,66 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+//go:build linux
+// +build linux
+
+package psi_test
+
+import (
+	"testing"
+
+	"pault.ag/go/psi"
+	"pault.ag/go/psi/psitest"
+)
+
+func TestTriggerBytes(t *testing.T) {
+	cgroup := testConfig
+	cgroup.CgroupPath = "system.slice/foo.service"
+	newline := testConfig
+	newline.TriggerTerminator = psi.TerminatorNewline
+
+	for _, test := range []struct {
+		name   string
+		config psi.Config
+		want   string
+	}{
+		{name: "proc", config: testConfig, want: "some 100000 1000000\x00"},
+		{name: "cgroup", config: cgroup, want: "some 100000 1000000\x00"},
+		{name: "newline", config: newline, want: "some 100000 1000000\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			source, err := psitest.NewSource("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			trigger, err := psi.NewTriggerFromSource(test.config, source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer trigger.Close()
+
+			if got := string(source.Written()); got != test.want {
+				t.Fatalf("wrote %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// vim: foldmethod=marker
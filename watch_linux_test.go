@@ -0,0 +1,98 @@
+// {{{ Copyright (c) Paul R. Tagliamonte <paultag@gmail.com>, 2019
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE. }}}
+
+//go:build linux
+// +build linux
+
+package psi_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"pault.ag/go/psi"
+	"pault.ag/go/psi/psitest"
+)
+
+// benchmarkWatch will set up n Triggers on Sources, and time how long it
+// takes watch to notice one of them firing. Only the last one ever fires,
+// so poll has to go through all of them to find it, and epoll doesn't.
+func benchmarkWatch(
+	b *testing.B,
+	n int,
+	watch func(context.Context, []*psi.Trigger, func(int) error) error,
+) {
+	triggers := make([]*psi.Trigger, n)
+	var source *psitest.Source
+	for i := range triggers {
+		var err error
+		source, err = psitest.NewSource("")
+		if err != nil {
+			b.Fatal(err)
+		}
+		triggers[i], err = psi.NewTriggerFromSource(testConfig, source)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer triggers[i].Close()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fired := make(chan int)
+	done := make(chan error, 1)
+	go func() {
+		done <- watch(ctx, triggers, func(i int) error {
+			fired <- i
+			return nil
+		})
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := source.Fire(); err != nil {
+			b.Fatal(err)
+		}
+		select {
+		case <-fired:
+		case err := <-done:
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	cancel()
+	<-done
+}
+
+func BenchmarkWatch(b *testing.B) {
+	for _, n := range []int{100, 1000} {
+		b.Run(fmt.Sprintf("poll/%d", n), func(b *testing.B) {
+			benchmarkWatch(b, n, func(ctx context.Context, triggers []*psi.Trigger, cb func(int) error) error {
+				return psi.Watch(ctx, triggers, 0, nil, cb)
+			})
+		})
+		b.Run(fmt.Sprintf("epoll/%d", n), func(b *testing.B) {
+			benchmarkWatch(b, n, psi.WatchMany)
+		})
+	}
+}
+
+// vim: foldmethod=marker